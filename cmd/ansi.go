@@ -0,0 +1,83 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ANSIDim        = "dim"        // ANSI style that dims the erased text.
+	ANSIBackground = "background" // ANSI style that hides the erased text behind a black background.
+)
+
+// ansiStyles maps each ANSI style to the escape codes that start its erased text.
+var ansiStyles = map[string]string{
+	ANSIDim:        "\x1b[2m",
+	ANSIBackground: "\x1b[30;40m",
+}
+
+const (
+	ansiKept  = "\x1b[1m" // The escape code that starts kept text, in bold.
+	ansiReset = "\x1b[0m" // The escape code that resets the text style.
+)
+
+// WriteANSI writes the blackout poems for a color terminal, followed by their messages and attributions. The erased
+// text stays in place with the given ANSI style, and the kept text is bold, so that the message can be read in context.
+func WriteANSI(w io.Writer, blackouts []Blackout, style string) error {
+	erased, ok := ansiStyles[style]
+	if !ok {
+		return fmt.Errorf("Unknown ANSI style %q", style)
+	}
+	for _, b := range blackouts {
+		var text strings.Builder
+		for idx, line := range b.Lines() {
+			if idx > 0 {
+				text.WriteString("\n")
+			}
+			for _, run := range line {
+				switch {
+				case run.Kept:
+					text.WriteString(ansiKept + run.Text + ansiReset)
+				case run.Erased:
+					text.WriteString(erased + run.Text + ansiReset)
+				default:
+					text.WriteString(run.Text)
+				}
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s\n\n%s\n%s\n\n", text.String(), b.Message, b.Attribution())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colorsEnabled signals whether standard output is a terminal that should get colors, which isn't the case when it is
+// redirected or when the NO_COLOR environment variable is set.
+func colorsEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteANSI(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem", "Ipsum", "Dolor Sit\\nAmet"})
+	b, err := newBlackout(0, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		ANSIDim: "\x1b[2mDolor\x1b[0m \x1b[2mS\x1b[0m\x1b[1mit\x1b[0m\n" +
+			"\x1b[2mA\x1b[0m\x1b[1mme\x1b[0m\x1b[2mt\x1b[0m\n\nit me\nExcerpt of \"Lorem\" by Ipsum\n\n",
+		ANSIBackground: "\x1b[30;40mDolor\x1b[0m \x1b[30;40mS\x1b[0m\x1b[1mit\x1b[0m\n" +
+			"\x1b[30;40mA\x1b[0m\x1b[1mme\x1b[0m\x1b[30;40mt\x1b[0m\n\nit me\nExcerpt of \"Lorem\" by Ipsum\n\n",
+	}
+	for style, expected := range tests {
+		var buf bytes.Buffer
+		if err := WriteANSI(&buf, []Blackout{b}, style); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Fatalf("Unexpected %s output: %q", style, buf.String())
+		}
+	}
+	if err := WriteANSI(&bytes.Buffer{}, []Blackout{b}, "blink"); err == nil {
+		t.Fatal("Unknown ANSI styles should return an error")
+	}
+}
+
+func TestColorsEnabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if colorsEnabled() {
+		t.Fatal("Colors should be disabled with NO_COLOR")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+const (
+	FormatText = "text" // Output format that prints the blackout poem to the terminal with block characters.
+	FormatSVG  = "svg"  // Output format that draws the blackout poem as an SVG image with black bars.
+	FormatHTML = "html" // Output format that writes the blackout poem as an accessible HTML page.
+	FormatPNG  = "png"  // Output format that rasterizes the blackout poem into a PNG image.
+	FormatPDF  = "pdf"  // Output format that lays out the blackout poem on a PDF page for print.
+	FormatJSON = "json" // Output format that writes the blackout poem and its kept characters as JSON.
+	FormatANSI = "ansi" // Output format that prints the blackout poem to a color terminal, keeping the erased text dim.
+)
+
+// outputFormats lists every supported output format.
+var outputFormats = []string{FormatText, FormatSVG, FormatHTML, FormatPNG, FormatPDF, FormatJSON, FormatANSI}
+
+// A Blackout is a poem blacked out with a message.
+type Blackout struct {
+	ID      int        // The poem's ID.
+	Poem    ParsedPoem // The poem itself.
+	Message string     // The message hidden in the poem.
+	Text    string     // The poem's delineated text.
+	Kept    []Span     // The spans of the text that stay visible.
+}
+
+// OutputOptions are the options for writing blackout poems.
+type OutputOptions struct {
+	Format    string     // The output format.
+	PNG       PNGOptions // The options for PNG images.
+	ANSIStyle string     // The ANSI style of erased text on color terminals.
+	Eraser    Eraser     // The eraser for text output.
+}
+
+// A blackoutRun is a stretch of a blackout poem's line that is either kept, erased, or whitespace.
+type blackoutRun struct {
+	Text   string // The run's original text.
+	Kept   bool   // Whether the run stays visible.
+	Erased bool   // Whether the run is blacked out. Runs that are neither kept nor erased are whitespace.
+}
+
+// newBlackout blacks out the given poem with the message, using the given options.
+func newBlackout(poemID int, parsedPoem ParsedPoem, message string, opts MatchOptions) (Blackout, error) {
+	matcher, err := newMatcher(message, opts)
+	if err != nil {
+		return Blackout{}, err
+	}
+	text := delineate(parsedPoem)
+	spans, ok := matcher.Match(text)
+	if !ok {
+		return Blackout{}, errors.New("Message does not match blackout poem")
+	}
+	return Blackout{poemID, parsedPoem, message, text, spans}, nil
+}
+
+// Lines splits the blackout poem into its lines, each made of kept, erased and whitespace runs.
+func (b Blackout) Lines() [][]blackoutRun {
+	lines := [][]blackoutRun{{}}
+	addRun := func(run blackoutRun) {
+		line := &lines[len(lines)-1]
+		if last := len(*line) - 1; last >= 0 && (*line)[last].Kept == run.Kept && (*line)[last].Erased == run.Erased {
+			(*line)[last].Text += run.Text
+			return
+		}
+		*line = append(*line, run)
+	}
+	pos := 0
+	addText := func(end int, kept bool) {
+		for _, r := range b.Text[pos:end] {
+			switch {
+			case r == '\n':
+				lines = append(lines, []blackoutRun{})
+			case kept:
+				addRun(blackoutRun{string(r), true, false})
+			default:
+				addRun(blackoutRun{string(r), false, blackoutRP.MatchString(string(r))})
+			}
+		}
+		pos = end
+	}
+	for _, span := range b.Kept {
+		addText(span.Start, false)
+		addText(span.End, true)
+	}
+	addText(len(b.Text), false)
+	return lines
+}
+
+// Attribution returns the line crediting the poem that the blackout is an excerpt of, along with the stanzas and lines
+// that it uses if it only blacks out part of a longer poem. Windows of a longer poem are located by the character they
+// start at instead, since their stanzas and lines aren't counted from the start of the poem.
+func (b Blackout) Attribution() string {
+	attribution := fmt.Sprintf("Excerpt of \"%s\" by %s", b.Poem.Title, b.Poem.Author)
+	switch {
+	case b.Poem.IsWindow:
+		attribution += fmt.Sprintf(", from character %d", b.Poem.Offset+1)
+	case b.Poem.Excerpt != nil:
+		attribution += ", " + b.Poem.Excerpt.String()
+	}
+	return attribution
+}
+
+// writeBlackouts writes the blackout poems with the given output options.
+func writeBlackouts(w io.Writer, blackouts []Blackout, opts OutputOptions) error {
+	switch opts.Format {
+	case FormatText:
+		for _, b := range blackouts {
+			if err := PrintBlackoutPoem(w, b, opts.Eraser); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatSVG:
+		return WriteSVG(w, blackouts)
+	case FormatHTML:
+		return WriteHTML(w, blackouts)
+	case FormatPNG:
+		return WritePNG(w, blackouts, opts.PNG)
+	case FormatPDF:
+		return WritePDF(w, blackouts)
+	case FormatJSON:
+		return WriteJSON(w, blackouts, opts.Eraser)
+	case FormatANSI:
+		return WriteANSI(w, blackouts, opts.ANSIStyle)
+	default:
+		return fmt.Errorf("Unknown output format %q", opts.Format)
+	}
+}
+
+// textWidth returns the number of monospace columns that the text takes up.
+func textWidth(text string) int {
+	return uniseg.StringWidth(strings.ReplaceAll(text, "\t", "    "))
+}
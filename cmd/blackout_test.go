@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBlackoutLines(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem", "Ipsum", "Dolor Sit\\nAmet  sit"})
+	b, err := newBlackout(3, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]blackoutRun{
+		{{"Dolor", false, true}, {" ", false, false}, {"S", false, true}, {"it", true, false}},
+		{{"A", false, true}, {"me", true, false}, {"t", false, true}, {"  ", false, false}, {"sit", false, true}},
+	}
+	lines := b.Lines()
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected lines: %v", lines)
+	}
+	for idx := range lines {
+		if !slices.Equal(lines[idx], expected[idx]) {
+			t.Fatalf("Unexpected runs on line %d: %v", idx, lines[idx])
+		}
+	}
+	if b.ID != 3 || b.Attribution() != `Excerpt of "Lorem" by Ipsum` {
+		t.Fatalf("Unexpected blackout: %+v", b)
+	}
+	if _, err := newBlackout(3, poem, "xyz", MatchOptions{Mode: ModeLetters}); err == nil {
+		t.Fatal("Messages that don't fit should return an error")
+	}
+	poem.Excerpt = &Excerpt{2, 3, 4, 9}
+	b.Poem = poem
+	if b.Attribution() != `Excerpt of "Lorem" by Ipsum, stanzas 2–3, lines 4–9` {
+		t.Fatalf("Unexpected attribution of an excerpt: %s", b.Attribution())
+	}
+	b.Poem.Offset, b.Poem.IsWindow = 120, true
+	if b.Attribution() != `Excerpt of "Lorem" by Ipsum, from character 121` {
+		t.Fatalf("Unexpected attribution of a window: %s", b.Attribution())
+	}
+}
@@ -0,0 +1,418 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// publicDomainCorpus is the name of the corpus with the public domain poetry dataset, which is searched by default.
+const publicDomainCorpus = "public-domain"
+
+// importExtensions are the extensions of the files that can be imported as poems.
+var importExtensions = []string{".txt", ".text", ".md", ".markdown"}
+
+// ImportAuthor is the author of imported poems that don't name their own.
+var ImportAuthor string
+
+// A Corpus is a named collection of poems, kept in its own folder in the data folder.
+type Corpus struct {
+	Name    string // The corpus's name.
+	Folder  string // The corpus's folder.
+	JSON    string // Path to the downloaded poetry dataset JSON file, only used by the public domain corpus.
+	Imports string // Path to the JSON file with the poems imported into the corpus.
+	Store   string // Path to the corpus's poem store file.
+}
+
+// corpusCmd groups the sub-commands that manage the poem corpora.
+var corpusCmd = &cobra.Command{
+	Use:   "corpus",
+	Short: "Manage the corpora of poems that blackout poems are made from",
+	Long: `Manage the corpora of poems that blackout poems are made from. The
+public-domain corpus, with the public domain poetry dataset, is searched by
+default; choose other corpora to search with --corpus.`,
+	PersistentPreRun: setupCorpusCmd,
+}
+
+// corpusImportCmd imports poems from local files into a corpus.
+var corpusImportCmd = &cobra.Command{
+	Use:   "import <path>...",
+	Short: "Import poems from plain-text or Markdown files, or directories of them",
+	Long: `Import poems from plain-text (.txt, .text) or Markdown (.md, .markdown) files
+into the corpus given by --corpus, making it if it doesn't exist yet. Each file
+is one poem, and directories are searched recursively. A poem's title and author
+come from its front matter if it has any, or else its title is its first line.
+Poems that were already imported are skipped.`,
+	Example: `blackout corpus import poem.txt
+blackout corpus import ~/poems --author 'Jane Doe'
+blackout corpus import ~/notes --corpus team-notes`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runImport,
+}
+
+// corpusListCmd lists the corpora in the data folder.
+var corpusListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the corpora and how many poems they have",
+	Args:  cobra.NoArgs,
+	Run:   runList,
+}
+
+// corpusRemoveCmd removes corpora from the data folder.
+var corpusRemoveCmd = &cobra.Command{
+	Use:   "remove <corpus>...",
+	Short: "Remove corpora along with the poems imported into them",
+	Long: `Remove corpora along with the poems imported into them. Removing the
+public-domain corpus deletes the downloaded poetry dataset, which is downloaded
+again the next time it is searched.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runRemove,
+}
+
+// init sets up the corpus sub-commands and their flags.
+func init() {
+	corpusImportCmd.Flags().StringVarP(&ImportAuthor, "author", "a", "Unknown", "author of imported poems without one in their front matter")
+	corpusCmd.AddCommand(corpusImportCmd, corpusListCmd, corpusRemoveCmd)
+	rootCmd.AddCommand(corpusCmd)
+}
+
+// newCorpus returns the corpus with the given name. Names can only have letters, digits, dashes and underscores.
+func newCorpus(name string) (Corpus, error) {
+	validName := name != "" && strings.IndexFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+	}) == -1
+	if !validName {
+		return Corpus{}, fmt.Errorf("Invalid corpus name %q; use only letters, digits, dashes and underscores", name)
+	}
+	folder := filepath.Join(dataFolderCorpora, name)
+	return Corpus{
+		name,
+		folder,
+		filepath.Join(folder, "poems.json"),
+		filepath.Join(folder, "imported.json"),
+		filepath.Join(folder, "poems.store"),
+	}, nil
+}
+
+// windowStore returns the path to the corpus's poem store file with its poems cut into windows of the given size.
+func (c Corpus) windowStore(windowSize int) string {
+	return filepath.Join(c.Folder, fmt.Sprintf("windows-%d.store", windowSize))
+}
+
+// listCorpora returns the names of the corpora in the data folder in alphabetical order. The public domain corpus is
+// always listed, even before its poetry dataset is downloaded.
+func listCorpora() ([]string, error) {
+	names := []string{publicDomainCorpus}
+	entries, err := os.ReadDir(dataFolderCorpora)
+	if err != nil && !os.IsNotExist(err) {
+		return names, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != publicDomainCorpus {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// setupCorpusCmd sets up the logging and the data folder for the corpus sub-commands.
+func setupCorpusCmd(cmd *cobra.Command, _ []string) {
+	if !Verbose {
+		log.SetOutput(io.Discard)
+	} else {
+		log.SetOutput(os.Stdout)
+	}
+	log.Printf("Running command %s\n", cmd.Name())
+	setupErr := setupCorporaFolder()
+	if setupErr != nil {
+		fmt.Printf("Could not set up the data folder %s: %s\n", dataFolder, setupErr)
+		log.Fatal(setupErr)
+	}
+}
+
+// runImport runs the `corpus import` sub-command.
+func runImport(_ *cobra.Command, args []string) {
+	if len(Corpora) != 1 {
+		fmt.Println("Choose a single corpus to import poems into with --corpus")
+		os.Exit(1)
+	}
+	corpus, corpusErr := newCorpus(Corpora[0])
+	if corpusErr != nil {
+		fmt.Println(corpusErr)
+		os.Exit(1)
+	}
+	poems := []Poem{}
+	for _, path := range args {
+		pathPoems, err := importPoems(path, ImportAuthor)
+		if err != nil {
+			fmt.Printf("Could not import poems from %s: %s\n", path, err)
+			log.Fatal(err)
+		}
+		poems = append(poems, pathPoems...)
+	}
+	added, addErr := addImportedPoems(poems, corpus.Imports, corpus.Store)
+	if addErr != nil {
+		fmt.Printf("Could not add the imported poems to the %s corpus: %s\n", corpus.Name, addErr)
+		log.Fatal(addErr)
+	}
+	fmt.Printf("Imported %d poems into the %s corpus\n", added, corpus.Name)
+	if added < len(poems) {
+		fmt.Printf("Skipped %d poems that were already imported\n", len(poems)-added)
+	}
+}
+
+// runList runs the `corpus list` sub-command.
+func runList(_ *cobra.Command, _ []string) {
+	names, err := listCorpora()
+	if err != nil {
+		fmt.Printf("Could not list the corpora in %s: %s\n", dataFolderCorpora, err)
+		log.Fatal(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		corpus, corpusErr := newCorpus(name)
+		if corpusErr != nil {
+			log.Printf("Skipping %s: %s\n", name, corpusErr)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", corpus.Name, describeCorpus(corpus))
+	}
+	w.Flush()
+}
+
+// describeCorpus describes how many poems the corpus has, or whether its poetry dataset still has to be downloaded or
+// parsed.
+func describeCorpus(corpus Corpus) string {
+	store, storeErr := openPoemStore(corpus.Store)
+	if storeErr == nil {
+		return fmt.Sprintf("%d poems", store.Len())
+	}
+	imported, importsErr := readImportedPoems(corpus.Imports)
+	if importsErr != nil {
+		return importsErr.Error()
+	}
+	if corpus.Name != publicDomainCorpus {
+		return fmt.Sprintf("%d poems", len(imported))
+	}
+	if _, jsonErr := os.Stat(corpus.JSON); jsonErr != nil {
+		return fmt.Sprintf("%d imported poems, poetry dataset not downloaded yet", len(imported))
+	}
+	return fmt.Sprintf("%d imported poems, poetry dataset not parsed yet", len(imported))
+}
+
+// runRemove runs the `corpus remove` sub-command.
+func runRemove(_ *cobra.Command, args []string) {
+	for _, name := range args {
+		corpus, corpusErr := newCorpus(name)
+		if corpusErr != nil {
+			fmt.Println(corpusErr)
+			os.Exit(1)
+		}
+		removeErr := removeCorpus(corpus)
+		if removeErr != nil {
+			fmt.Printf("Could not remove the %s corpus: %s\n", corpus.Name, removeErr)
+			log.Fatal(removeErr)
+		}
+		fmt.Printf("Removed the %s corpus\n", corpus.Name)
+	}
+}
+
+// removeCorpus removes the corpus's folder with everything in it.
+func removeCorpus(corpus Corpus) error {
+	_, statErr := os.Stat(corpus.Folder)
+	if os.IsNotExist(statErr) {
+		return fmt.Errorf("Corpus %s doesn't exist", corpus.Name)
+	}
+	if statErr != nil {
+		return statErr
+	}
+	return os.RemoveAll(corpus.Folder)
+}
+
+// importPoems reads the poems in the file or directory tree at the given path. Poems without an author in their front
+// matter are credited to the given author.
+func importPoems(path string, author string) ([]Poem, error) {
+	poems := []Poem{}
+	walkErr := filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip hidden files & directories, but not the path itself
+		if filePath != path && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		isPoemFile := slices.Contains(importExtensions, strings.ToLower(filepath.Ext(filePath)))
+		if !isPoemFile && filePath != path {
+			return nil
+		}
+		contents, readErr := os.ReadFile(filePath)
+		if readErr != nil {
+			return readErr
+		}
+		if !utf8.Valid(contents) {
+			return fmt.Errorf("%s is not a UTF-8 text file", filePath)
+		}
+		poem, ok := parsePoemFile(string(contents), filePath, author)
+		if !ok {
+			log.Printf("Skipping %s, which has no poem text\n", filePath)
+			return nil
+		}
+		log.Printf("Importing \"%s\" by %s from %s\n", poem.Title, poem.Author, filePath)
+		poems = append(poems, poem)
+		return nil
+	})
+	return poems, walkErr
+}
+
+// parsePoemFile parses the contents of a plain-text or Markdown poem file. The title and author come from the file's
+// front matter if it has any; otherwise, the title is the file's first line. It returns false if the file has no poem
+// text.
+func parsePoemFile(contents string, filePath string, author string) (Poem, bool) {
+	contents = strings.ReplaceAll(contents, "\r\n", "\n")
+	contents = strings.TrimPrefix(contents, "\ufeff")
+	lines := strings.Split(contents, "\n")
+	poem := Poem{Author: author}
+	// Read the front matter between two `---` lines
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for idx := 1; idx < len(lines); idx++ {
+			if strings.TrimSpace(lines[idx]) == "---" {
+				for _, field := range lines[1:idx] {
+					key, value, found := strings.Cut(field, ":")
+					value = strings.Trim(strings.TrimSpace(value), `"'`)
+					if !found || value == "" {
+						continue
+					}
+					switch strings.ToLower(strings.TrimSpace(key)) {
+					case "title":
+						poem.Title = value
+					case "author":
+						poem.Author = value
+					}
+				}
+				lines = lines[idx+1:]
+				break
+			}
+		}
+	}
+	// Trim the blank lines around the poem's text
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if poem.Title == "" && len(lines) > 0 {
+		// Use the first line (or Markdown heading) as the title
+		poem.Title = strings.TrimSpace(strings.TrimLeft(lines[0], "#"))
+		lines = lines[1:]
+		for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+			lines = lines[1:]
+		}
+	}
+	if poem.Title == "" {
+		poem.Title = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	}
+	if len(lines) == 0 {
+		return poem, false
+	}
+	poem.Text = strings.Join(lines, "\\n")
+	return poem, true
+}
+
+// readImportedPoems reads the poems that were imported into the poem store, which are kept in a JSON file so that the
+// poem store can be rebuilt with them. It returns no poems if none were imported.
+func readImportedPoems(importsPath string) ([]Poem, error) {
+	_, statErr := os.Stat(importsPath)
+	if errors.Is(statErr, os.ErrNotExist) {
+		return []Poem{}, nil
+	}
+	return readPoemsJSON(importsPath)
+}
+
+// addImportedPoems adds the poems to the imported poems JSON file, and to the end of the poem store if it has already
+// been built. Otherwise, they are parsed along with the rest of the poems when the poem store is built. Poems that were
+// already imported (with the same title, author and text) are skipped, so that importing the same files again doesn't
+// add them twice. It returns how many poems were added.
+func addImportedPoems(poems []Poem, importsPath string, storePath string) (int, error) {
+	mkdirErr := os.MkdirAll(filepath.Dir(importsPath), 0o750)
+	if mkdirErr != nil {
+		return 0, mkdirErr
+	}
+	imported, readErr := readImportedPoems(importsPath)
+	if readErr != nil {
+		return 0, readErr
+	}
+	newPoems := []Poem{}
+	for _, poem := range poems {
+		if slices.Contains(imported, poem) {
+			log.Printf("Skipping \"%s\" by %s, which was already imported\n", poem.Title, poem.Author)
+			continue
+		}
+		newPoems = append(newPoems, poem)
+	}
+	if len(newPoems) == 0 {
+		return 0, nil
+	}
+	importsJSON, jsonErr := json.Marshal(append(imported, newPoems...))
+	if jsonErr != nil {
+		return 0, jsonErr
+	}
+	writeErr := os.WriteFile(importsPath, importsJSON, 0o666)
+	if writeErr != nil {
+		return 0, writeErr
+	}
+	// The poem stores of windows are rebuilt with the imported poems the next time they're searched
+	windowStores, _ := filepath.Glob(filepath.Join(filepath.Dir(storePath), "windows-*.store"))
+	for _, windowStore := range windowStores {
+		removeErr := os.Remove(windowStore)
+		if removeErr != nil {
+			return 0, removeErr
+		}
+	}
+	_, storeErr := openPoemStore(storePath)
+	if storeErr != nil {
+		log.Printf("Poem store isn't built yet (%s); it will include the imported poems\n", storeErr)
+		return len(newPoems), nil
+	}
+	parsedPoems := make([]ParsedPoem, len(newPoems))
+	for idx, poem := range newPoems {
+		parsedPoems[idx] = NewParsedPoem(poem)
+	}
+	return len(newPoems), appendPoemStore(parsedPoems, storePath)
+}
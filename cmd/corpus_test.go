@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParsePoemFile(t *testing.T) {
+	tests := []struct {
+		contents string
+		poem     Poem
+		ok       bool
+	}{
+		{"Title\n\nline one\r\nline two\n\n", Poem{"Title", "Me", "line one\\nline two"}, true},
+		{"# Heading\nline one\n", Poem{"Heading", "Me", "line one"}, true},
+		{"---\ntitle: \"Front\"\nauthor: 'Them'\ntags: a, b\n---\nline one\n  line two", Poem{"Front", "Them", "line one\\n  line two"}, true},
+		{"---\nauthor: Them\n---\n\nFirst\nline one\n", Poem{"First", "Them", "line one"}, true},
+		{"\ufeffTitle\nline one", Poem{"Title", "Me", "line one"}, true},
+		{"Only a title\n", Poem{}, false},
+		{"---\ntitle: Empty\n---\n", Poem{}, false},
+	}
+	for _, test := range tests {
+		poem, ok := parsePoemFile(test.contents, "poems/file.txt", "Me")
+		if ok != test.ok || (ok && poem != test.poem) {
+			t.Fatalf("Unexpected poem for %q: %+v, %t", test.contents, poem, ok)
+		}
+	}
+}
+
+func TestImportPoems(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"one.txt":              "One\nthe first poem",
+		"sub/two.md":           "---\ntitle: Two\nauthor: Someone\n---\nthe second poem",
+		"sub/.hidden/three.md": "Three\nthe hidden poem",
+		".four.txt":            "Four\nanother hidden poem",
+		"notes.csv":            "Notes\nnot,a,poem",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poems, err := importPoems(dir, "Me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Poem{{"One", "Me", "the first poem"}, {"Two", "Someone", "the second poem"}}
+	if !slices.Equal(poems, expected) {
+		t.Fatalf("Unexpected imported poems: %+v", poems)
+	}
+	// Single files are imported whatever their extension
+	poems, err = importPoems(filepath.Join(dir, "notes.csv"), "Me")
+	if err != nil || !slices.Equal(poems, []Poem{{"Notes", "Me", "not,a,poem"}}) {
+		t.Fatalf("Unexpected poems from a single file: %+v, %v", poems, err)
+	}
+	if _, err := importPoems(filepath.Join(dir, "missing"), "Me"); err == nil {
+		t.Fatal("Importing a missing path should return an error")
+	}
+}
+
+func TestAddImportedPoems(t *testing.T) {
+	dir := t.TempDir()
+	importsPath, storePath := filepath.Join(dir, "imported.json"), filepath.Join(dir, "poems.store")
+	first, second := Poem{"One", "Me", "the first poem"}, Poem{"Two", "Me", "the second poem"}
+	// Without a poem store, the poems are only kept for when it is built
+	if added, err := addImportedPoems([]Poem{first}, importsPath, storePath); err != nil || added != 1 {
+		t.Fatalf("Unexpected import of %d poems: %v", added, err)
+	}
+	if _, err := os.Stat(storePath); !os.IsNotExist(err) {
+		t.Fatal("Importing poems should not build the poem store")
+	}
+	if err := writePoemStore([]ParsedPoem{nonProfaneParsedPoem}, storePath); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := addImportedPoems([]Poem{second}, importsPath, storePath); err != nil || added != 1 {
+		t.Fatalf("Unexpected import of %d poems: %v", added, err)
+	}
+	// Importing the same poems again skips them
+	if added, err := addImportedPoems([]Poem{first, second}, importsPath, storePath); err != nil || added != 0 {
+		t.Fatalf("Unexpected import of %d already imported poems: %v", added, err)
+	}
+	imported, err := readImportedPoems(importsPath)
+	if err != nil || !slices.Equal(imported, []Poem{first, second}) {
+		t.Fatalf("Unexpected imported poems: %+v, %v", imported, err)
+	}
+	store, err := openPoemStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Store has %d poems instead of 2", store.Len())
+	}
+	for poemID, parsedPoem := range []ParsedPoem{nonProfaneParsedPoem, NewParsedPoem(second)} {
+		storePoem, err := store.Poem(poemID)
+		if err != nil || !samePoem(storePoem, parsedPoem) {
+			t.Fatalf("Unexpected poem %d in the store: %+v, %v", poemID, storePoem, err)
+		}
+	}
+}
+
+// useTempDataFolder points the data folder at a temporary folder until the end of the test.
+func useTempDataFolder(t *testing.T) {
+	paths := []*string{&dataFolder, &dataFolderCorpora, &legacyFolderJSON, &legacyFolderStore, &legacyFolderImports, &legacyFolderPoems}
+	oldPaths := []string{}
+	for _, path := range paths {
+		oldPaths = append(oldPaths, *path)
+	}
+	t.Cleanup(func() {
+		for idx, path := range paths {
+			*path = oldPaths[idx]
+		}
+	})
+	dataFolder = t.TempDir()
+	dataFolderCorpora = filepath.Join(dataFolder, "corpora")
+	legacyFolderJSON = filepath.Join(dataFolder, "poems.json")
+	legacyFolderStore = filepath.Join(dataFolder, "poems.store")
+	legacyFolderImports = filepath.Join(dataFolder, "imported.json")
+	legacyFolderPoems = filepath.Join(dataFolder, "poems")
+}
+
+func TestNewCorpus(t *testing.T) {
+	for _, name := range []string{"public-domain", "team_notes", "Gedichte2"} {
+		corpus, err := newCorpus(name)
+		if err != nil || corpus.Name != name || filepath.Dir(corpus.Store) != filepath.Join(dataFolderCorpora, name) {
+			t.Fatalf("Unexpected corpus for %q: %+v, %v", name, corpus, err)
+		}
+	}
+	for _, name := range []string{"", "..", "../notes", "my notes", "notes/poems"} {
+		if _, err := newCorpus(name); err == nil {
+			t.Fatalf("Corpus name %q should be invalid", name)
+		}
+	}
+}
+
+func TestSetupDataFolder(t *testing.T) {
+	useTempDataFolder(t)
+	// Data folder of an older version
+	dataset, imported, note := Poem{"One", "Someone", "the first poem"}, Poem{"Two", "Me", "the second poem"}, Poem{"Three", "Me", "a note"}
+	datasetJSON, _ := json.Marshal([]Poem{dataset})
+	if err := os.WriteFile(legacyFolderJSON, datasetJSON, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addImportedPoems([]Poem{imported}, legacyFolderImports, legacyFolderStore); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacyFolderStore, []byte("old poem store"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupCorporaFolder(); err != nil {
+		t.Fatal(err)
+	}
+	for _, legacyPath := range []string{legacyFolderJSON, legacyFolderStore, legacyFolderImports} {
+		if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been moved or removed", legacyPath)
+		}
+	}
+	// Search the public domain corpus, then a corpus of notes
+	notes, _ := newCorpus("notes")
+	if _, err := addImportedPoems([]Poem{note}, notes.Imports, notes.Store); err != nil {
+		t.Fatal(err)
+	}
+	stores, err := setupDataFolder([]string{publicDomainCorpus, notes.Name}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stores) != 2 || stores.Len() != 3 {
+		t.Fatalf("Unexpected poem stores with %d poems", stores.Len())
+	}
+	for poemID, poem := range []Poem{dataset, imported, note} {
+		storePoem, err := stores.Poem(poemID)
+		if err != nil || !samePoem(storePoem, NewParsedPoem(poem)) {
+			t.Fatalf("Unexpected poem %d: %+v, %v", poemID, storePoem, err)
+		}
+	}
+	// Search windows of the notes
+	stores, err = setupDataFolder([]string{notes.Name}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for poemID, text := range []string{"a", "note"} {
+		if window, err := stores.Poem(poemID); err != nil || window.Text != text || window.Length > 4 || !window.IsWindow {
+			t.Fatalf("Unexpected window %d of the notes: %+v, %v", poemID, window, err)
+		}
+	}
+	if _, err := addImportedPoems([]Poem{{"Four", "Me", "another note"}}, notes.Imports, notes.Store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(notes.windowStore(4)); !os.IsNotExist(err) {
+		t.Fatal("Importing poems should remove the corpus's poem stores of windows")
+	}
+	if _, err := setupDataFolder([]string{"missing"}, 0); err == nil {
+		t.Fatal("Setting up a missing corpus should fail")
+	}
+	// List & remove the corpora
+	names, err := listCorpora()
+	if err != nil || !slices.Equal(names, []string{"notes", publicDomainCorpus}) {
+		t.Fatalf("Unexpected corpora: %v, %v", names, err)
+	}
+	if err := removeCorpus(notes); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeCorpus(notes); err == nil {
+		t.Fatal("Removing a missing corpus should fail")
+	}
+	names, err = listCorpora()
+	if err != nil || !slices.Equal(names, []string{publicDomainCorpus}) {
+		t.Fatalf("Unexpected corpora after removing one: %v, %v", names, err)
+	}
+}
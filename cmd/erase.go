@@ -0,0 +1,131 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EraseBlock      = "block"      // Erasure style that replaces every erased character with a full block.
+	EraseStrike     = "strike"     // Erasure style that strikes through every erased character.
+	EraseSpace      = "space"      // Erasure style that replaces every erased character with a space.
+	EraseUnderscore = "underscore" // Erasure style that replaces every erased character with an underscore.
+	EraseBars       = "bars"       // Erasure style that redacts erased words, and the spaces between them, with bars.
+)
+
+// blanks are the whitespace characters that are never erased.
+const blanks = "\t\f\r\n "
+
+// An Eraser renders the erased text of a blackout poem.
+type Eraser interface {
+	// Erase returns what to print in place of a stretch of erased text. The stretch is on a single line, starts and
+	// ends with non-whitespace characters, and may have whitespace in between.
+	Erase(text string) string
+}
+
+// A RuneEraser replaces every erased non-whitespace character with the same character, keeping whitespace as it is.
+type RuneEraser struct {
+	Rune rune // The character printed in place of erased characters.
+}
+
+// Erase replaces the text's non-whitespace characters with the eraser's character.
+func (re RuneEraser) Erase(text string) string {
+	return blackoutRP.ReplaceAllLiteralString(text, string(re.Rune))
+}
+
+// A StrikeEraser strikes through every erased non-whitespace character with a combining long stroke overlay.
+type StrikeEraser struct{}
+
+// Erase adds a long stroke overlay (U+0336) after each of the text's non-whitespace characters.
+func (StrikeEraser) Erase(text string) string {
+	var struck strings.Builder
+	for _, char := range graphemes(text) {
+		struck.WriteString(char)
+		if !strings.ContainsAny(char, blanks) {
+			struck.WriteRune('\u0336')
+		}
+	}
+	return struck.String()
+}
+
+// A BarEraser redacts erased text with bars as long as the text, filling in the whitespace between erased words so
+// that a stretch of them collapses into a single bar.
+type BarEraser struct {
+	Rune rune // The character that the bars are made of.
+}
+
+// Erase replaces every character of the text, including whitespace, with the eraser's character.
+func (be BarEraser) Erase(text string) string {
+	return strings.Repeat(string(be.Rune), utf8.RuneCountInString(text))
+}
+
+// NewEraser returns the eraser for the given erasure style, which can also be any single character to erase with.
+func NewEraser(style string) (Eraser, error) {
+	switch style {
+	case EraseBlock:
+		return RuneEraser{'█'}, nil
+	case EraseStrike:
+		return StrikeEraser{}, nil
+	case EraseSpace:
+		return RuneEraser{' '}, nil
+	case EraseUnderscore:
+		return RuneEraser{'_'}, nil
+	case EraseBars:
+		return BarEraser{'█'}, nil
+	}
+	if r, size := utf8.DecodeRuneInString(style); size > 0 && size == len(style) && r != utf8.RuneError {
+		return RuneEraser{r}, nil
+	}
+	return nil, fmt.Errorf("Unknown erasure style %q", style)
+}
+
+// Render renders the blackout poem as text, with the eraser printing in place of the erased text.
+func (b Blackout) Render(eraser Eraser) string {
+	return eraseText(b.Text, b.Kept, eraser)
+}
+
+// eraseText renders the text with the eraser printing in place of everything outside of the given kept spans.
+func eraseText(text string, spans []Span, eraser Eraser) string {
+	var rendered strings.Builder
+	// Erase each line of the text between kept spans, leaving the whitespace around it as it is
+	erase := func(gap string) {
+		for idx, line := range strings.Split(gap, "\n") {
+			if idx > 0 {
+				rendered.WriteString("\n")
+			}
+			core := strings.Trim(line, blanks)
+			if core == "" {
+				rendered.WriteString(line)
+				continue
+			}
+			start := strings.Index(line, core)
+			rendered.WriteString(line[:start] + eraser.Erase(core) + line[start+len(core):])
+		}
+	}
+	pos := 0
+	for _, span := range spans {
+		erase(text[pos:span.Start])
+		rendered.WriteString(text[span.Start:span.End])
+		pos = span.End
+	}
+	erase(text[pos:])
+	return rendered.String()
+}
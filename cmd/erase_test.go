@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestErasers(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem", "Ipsum", "Dolor sit, Amet\\n  ipsum  "})
+	b, err := newBlackout(0, poem, "sit", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		style    string
+		rendered string
+	}{
+		{EraseBlock, "█████ sit█ ████\n  █████  "},
+		{EraseStrike, "D̶o̶l̶o̶r̶ sit,̶ A̶m̶e̶t̶\n  i̶p̶s̶u̶m̶  "},
+		{EraseSpace, "      sit      \n         "},
+		{EraseUnderscore, "_____ sit_ ____\n  _____  "},
+		{EraseBars, "█████ sit██████\n  █████  "},
+		{"x", "xxxxx sitx xxxx\n  xxxxx  "},
+		{"▒", "▒▒▒▒▒ sit▒ ▒▒▒▒\n  ▒▒▒▒▒  "},
+	}
+	for _, test := range tests {
+		eraser, err := NewEraser(test.style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered := b.Render(eraser); rendered != test.rendered {
+			t.Fatalf("Unexpected %s erasure: %q", test.style, rendered)
+		}
+	}
+	for _, style := range []string{"", "blocks", "xy"} {
+		if _, err := NewEraser(style); err == nil {
+			t.Fatalf("Unknown erasure style %q should return an error", style)
+		}
+	}
+	if renderBlackout(b.Text, b.Kept) != b.Render(RuneEraser{'█'}) {
+		t.Fatal("Blackouts should be rendered with full blocks by default")
+	}
+	// Text output goes to the given writer
+	var buf bytes.Buffer
+	if err := writeBlackouts(&buf, []Blackout{b}, OutputOptions{FormatText, PNGOptions{}, ANSIDim, RuneEraser{'█'}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "█████ sit█ ████\n  █████  \n\nsit\nExcerpt of \"Lorem\" by Ipsum\n\n"; buf.String() != expected {
+		t.Fatalf("Unexpected text output: %q", buf.String())
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Excerpt is a range of whole stanzas (or lines) out of a longer poem. Lines are counted without the blank lines
+// between stanzas, and stanzas and lines are both counted from 1.
+type Excerpt struct {
+	FirstStanza int // The excerpt's first stanza.
+	LastStanza  int // The excerpt's last stanza.
+	FirstLine   int // The excerpt's first line.
+	LastLine    int // The excerpt's last line.
+}
+
+// String describes the stanzas and lines of the excerpt, like "stanzas 2–3, lines 5–12".
+func (e Excerpt) String() string {
+	describe := func(unit string, first int, last int) string {
+		if first == last {
+			return fmt.Sprintf("%s %d", unit, first)
+		}
+		return fmt.Sprintf("%ss %d–%d", unit, first, last)
+	}
+	return describe("stanza", e.FirstStanza, e.LastStanza) + ", " + describe("line", e.FirstLine, e.LastLine)
+}
+
+// poemExcerpts returns the longest excerpts of the parsed poem that are at most the maximum length, starting from each
+// of its stanzas. If even its single stanzas are too long, then the excerpts start from each of its lines instead.
+// Excerpts that are part of the excerpt before them are left out.
+func poemExcerpts(parsedPoem ParsedPoem, maxLength int) []ParsedPoem {
+	lines := strings.Split(parsedPoem.Text, "\\n")
+	starts := make([]int, len(lines))
+	for idx := 1; idx < len(lines); idx++ {
+		starts[idx] = starts[idx-1] + len(lines[idx-1]) + len("\\n")
+	}
+	// Number the stanzas & lines, and find the units (stanzas or lines) that excerpts are made of
+	stanzaNumbers, lineNumbers := make([]int, len(lines)), make([]int, len(lines))
+	stanzas, units := [][2]int{}, [][2]int{}
+	nLines, stanzaFits := 0, false
+	for idx, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		nLines++
+		lineNumbers[idx] = nLines
+		if idx == 0 || strings.TrimSpace(lines[idx-1]) == "" {
+			stanzas = append(stanzas, [2]int{idx, idx})
+		}
+		stanzas[len(stanzas)-1][1] = idx
+		stanzaNumbers[idx] = len(stanzas)
+		units = append(units, [2]int{idx, idx})
+	}
+	for _, stanza := range stanzas {
+		stanzaFits = stanzaFits || starts[stanza[1]]+len(lines[stanza[1]])-starts[stanza[0]] <= maxLength
+	}
+	if stanzaFits {
+		units = stanzas
+	}
+	excerpts := []ParsedPoem{}
+	lastEnd := -1
+	for first := range units {
+		start := starts[units[first][0]]
+		last := first - 1
+		for last+1 < len(units) && starts[units[last+1][1]]+len(lines[units[last+1][1]])-start <= maxLength {
+			last++
+		}
+		if last < first || last == lastEnd {
+			continue
+		}
+		lastEnd = last
+		firstLine, lastLine := units[first][0], units[last][1]
+		text := parsedPoem.Text[start : starts[lastLine]+len(lines[lastLine])]
+		excerpts = append(excerpts, ParsedPoem{
+			parsedPoem.Title,
+			parsedPoem.Author,
+			text,
+			len(text),
+			parsedPoem.IsProfane,
+			countRunes(strings.ReplaceAll(text, "\\n", "\n")),
+			parsedPoem.Offset + utf8.RuneCountInString(strings.ReplaceAll(parsedPoem.Text[:start], "\\n", "\n")),
+			parsedPoem.IsWindow,
+			&Excerpt{stanzaNumbers[firstLine], stanzaNumbers[lastLine], lineNumbers[firstLine], lineNumbers[lastLine]},
+		})
+	}
+	return excerpts
+}
+
+// bestExcerpt finds the excerpt of the parsed poem, at most the maximum length, with the best-scoring blackout by the
+// matcher. Ties go to the earliest excerpt. It returns false if no excerpt can be blacked out.
+func bestExcerpt(parsedPoem ParsedPoem, matcher Matcher, maxLength int) (ParsedPoem, bool) {
+	best, bestScore, found := ParsedPoem{}, 0.0, false
+	for _, excerpt := range poemExcerpts(parsedPoem, maxLength) {
+		delineatedExcerpt := delineate(excerpt)
+		spans, ok := matcher.Match(delineatedExcerpt)
+		if !ok {
+			continue
+		}
+		score := scoreBlackout(delineatedExcerpt, spans).Total
+		if !found || score > bestScore {
+			best, bestScore, found = excerpt, score, true
+		}
+	}
+	return best, found
+}
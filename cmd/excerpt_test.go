@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+// stanzaPoem is a poem with three stanzas, separated by blank lines.
+var stanzaPoem = NewParsedPoem(Poem{"Stanzas", "Ipsum", `lorem ipsum\ndolor sit\n\namet café\nconsectetur\n\n\nadipiscing\nelit`})
+
+func TestExcerptString(t *testing.T) {
+	tests := map[Excerpt]string{
+		{1, 1, 2, 2}: "stanza 1, line 2",
+		{1, 1, 1, 4}: "stanza 1, lines 1–4",
+		{2, 3, 3, 6}: "stanzas 2–3, lines 3–6",
+	}
+	for excerpt, expected := range tests {
+		if excerpt.String() != expected {
+			t.Fatalf("Unexpected description of %+v: %s", excerpt, excerpt.String())
+		}
+	}
+}
+
+func TestPoemExcerpts(t *testing.T) {
+	tests := []struct {
+		maxLength int
+		texts     []string
+		excerpts  []Excerpt
+		offsets   []int
+	}{
+		// Stanzas 1 & 2, then 2 & 3
+		{50, []string{`lorem ipsum\ndolor sit\n\namet café\nconsectetur`, `amet café\nconsectetur\n\n\nadipiscing\nelit`},
+			[]Excerpt{{1, 2, 1, 4}, {2, 3, 3, 6}}, []int{0, 23}},
+		// Single stanzas
+		{24, []string{`lorem ipsum\ndolor sit`, `amet café\nconsectetur`, `adipiscing\nelit`},
+			[]Excerpt{{1, 1, 1, 2}, {2, 2, 3, 4}, {3, 3, 5, 6}}, []int{0, 23, 47}},
+		// Single lines, when no stanza fits
+		{11, []string{`lorem ipsum`, `dolor sit`, `amet café`, `consectetur`, `adipiscing`, `elit`},
+			[]Excerpt{{1, 1, 1, 1}, {1, 1, 2, 2}, {2, 2, 3, 3}, {2, 2, 4, 4}, {3, 3, 5, 5}, {3, 3, 6, 6}}, []int{0, 12, 23, 33, 47, 58}},
+	}
+	for _, test := range tests {
+		excerpts := poemExcerpts(stanzaPoem, test.maxLength)
+		texts, ranges, offsets := []string{}, []Excerpt{}, []int{}
+		for _, excerpt := range excerpts {
+			texts = append(texts, excerpt.Text)
+			ranges = append(ranges, *excerpt.Excerpt)
+			offsets = append(offsets, excerpt.Offset)
+			if excerpt.Length > test.maxLength || excerpt.Title != stanzaPoem.Title || excerpt.Author != stanzaPoem.Author {
+				t.Fatalf("Excerpt doesn't fit or lost its attribution: %+v", excerpt)
+			}
+		}
+		if !slices.Equal(texts, test.texts) || !slices.Equal(ranges, test.excerpts) || !slices.Equal(offsets, test.offsets) {
+			t.Fatalf("Unexpected excerpts with maximum length %d: %q, %v, %v", test.maxLength, texts, ranges, offsets)
+		}
+	}
+	if excerpts := poemExcerpts(stanzaPoem, 5); len(excerpts) != 1 || excerpts[0].Text != "elit" {
+		t.Fatalf("Only the lines that fit should be excerpts: %+v", excerpts)
+	}
+}
+
+func TestBestExcerpt(t *testing.T) {
+	matcher, err := newMatcher("amet", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both excerpts have the word, so the one with the best-scoring blackout is picked
+	excerpt, ok := bestExcerpt(stanzaPoem, matcher, 50)
+	if !ok {
+		t.Fatal("Both excerpts should fit the message")
+	}
+	for _, other := range poemExcerpts(stanzaPoem, 50) {
+		spans, _ := matcher.Match(delineate(other))
+		bestSpans, _ := matcher.Match(delineate(excerpt))
+		if scoreBlackout(delineate(other), spans).Total > scoreBlackout(delineate(excerpt), bestSpans).Total {
+			t.Fatalf("Excerpt %s scores better than the best excerpt %s", other.Excerpt, excerpt.Excerpt)
+		}
+	}
+	matcher, err = newMatcher("amet elit", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excerpt, ok = bestExcerpt(stanzaPoem, matcher, 50)
+	if !ok || *excerpt.Excerpt != (Excerpt{2, 3, 3, 6}) {
+		t.Fatalf("Unexpected best excerpt: %+v, %t", excerpt, ok)
+	}
+	matcher, err = newMatcher("lorem elit", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excerpt, ok := bestExcerpt(stanzaPoem, matcher, 50); ok {
+		t.Fatalf("No excerpt should fit the message: %+v", excerpt)
+	}
+}
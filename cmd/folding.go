@@ -0,0 +1,162 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A textFolder normalizes text so that characters match regardless of their case or diacritics.
+type textFolder struct {
+	IgnoreCase     bool // Whether to fold upper- and lower-case letters together.
+	FoldDiacritics bool // Whether to strip accents and other diacritics from letters.
+}
+
+// isIdentity signals whether the folder leaves text as it is.
+func (tf textFolder) isIdentity() bool {
+	return !tf.IgnoreCase && !tf.FoldDiacritics
+}
+
+// foldRune normalizes a single character, which can turn it into several characters or none at all.
+func (tf textFolder) foldRune(r rune, caser cases.Caser) string {
+	folded := string(r)
+	if tf.FoldDiacritics {
+		// Decompose the character, and drop its combining marks
+		folded = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) {
+				return -1
+			}
+			return r
+		}, norm.NFD.String(folded))
+	}
+	if tf.IgnoreCase {
+		folded = caser.String(folded)
+	}
+	return folded
+}
+
+// foldString normalizes the text.
+func (tf textFolder) foldString(text string) string {
+	folded, _, _ := tf.fold(text)
+	return folded
+}
+
+// fold normalizes the text. For every byte of the folded text, it also returns the offsets where the original
+// character that it came from starts and ends. Characters that fold into nothing are counted as part of the one
+// before them.
+func (tf textFolder) fold(text string) (string, []int, []int) {
+	caser := cases.Fold()
+	var folded strings.Builder
+	starts := make([]int, 0, len(text))
+	ends := make([]int, 0, len(text))
+	for offset, r := range text {
+		end := offset + len(string(r))
+		foldedRune := tf.foldRune(r, caser)
+		if foldedRune == "" {
+			// Extend the previous character to cover this one
+			for idx := len(ends) - 1; idx >= 0 && ends[idx] == offset; idx-- {
+				ends[idx] = end
+			}
+			continue
+		}
+		folded.WriteString(foldedRune)
+		for range len(foldedRune) {
+			starts = append(starts, offset)
+			ends = append(ends, end)
+		}
+	}
+	return folded.String(), starts, ends
+}
+
+// foldCounts normalizes the character counts of a text into the counts of its folded text.
+func (tf textFolder) foldCounts(runeCounts map[rune]int) map[rune]int {
+	if tf.isIdentity() {
+		return runeCounts
+	}
+	caser := cases.Fold()
+	folded := make(map[rune]int, len(runeCounts))
+	for r, count := range runeCounts {
+		for _, foldedRune := range tf.foldRune(r, caser) {
+			folded[foldedRune] += count
+		}
+	}
+	return folded
+}
+
+// hasRunes signals whether a text with the given character counts has at least as many of each folded character as
+// needed. Only the needed characters are counted, and ASCII characters are folded without normalizing them, so that
+// checking every poem of a search stays cheap.
+func (tf textFolder) hasRunes(runeCounts map[rune]int, needed map[rune]int) bool {
+	if tf.isIdentity() {
+		return hasRunes(runeCounts, needed)
+	}
+	var caser *cases.Caser
+	folded := make(map[rune]int, len(needed))
+	for r, count := range runeCounts {
+		if r < utf8.RuneSelf {
+			if tf.IgnoreCase {
+				r = unicode.ToLower(r)
+			}
+			if _, ok := needed[r]; ok {
+				folded[r] += count
+			}
+			continue
+		}
+		if caser == nil {
+			fold := cases.Fold()
+			caser = &fold
+		}
+		for _, foldedRune := range tf.foldRune(r, *caser) {
+			if _, ok := needed[foldedRune]; ok {
+				folded[foldedRune] += count
+			}
+		}
+	}
+	return hasRunes(folded, needed)
+}
+
+// foldingMatcher matches a folded message against folded poems, and keeps the poems' original characters.
+type foldingMatcher struct {
+	matcher Matcher    // The matcher for the folded message.
+	folder  textFolder // The folder for the poems' text.
+}
+
+// Match folds the text, matches the folded message against it, and maps the kept spans back to the original text.
+func (fm foldingMatcher) Match(text string) ([]Span, bool) {
+	folded, starts, ends := fm.folder.fold(text)
+	foldedSpans, ok := fm.matcher.Match(folded)
+	if !ok {
+		return nil, false
+	}
+	spans := make([]Span, 0, len(foldedSpans))
+	for _, span := range foldedSpans {
+		original := Span{starts[span.Start], ends[span.End-1]}
+		// A character that folds into several ones may be kept by more than one span
+		if len(spans) > 0 && original.Start < spans[len(spans)-1].End {
+			spans[len(spans)-1].End = max(spans[len(spans)-1].End, original.End)
+			continue
+		}
+		spans = append(spans, original)
+	}
+	return mergeSpans(spans), true
+}
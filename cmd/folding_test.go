@@ -0,0 +1,64 @@
+package cmd
+
+import "testing"
+
+func TestFoldingMatcher(t *testing.T) {
+	tests := []struct {
+		message  string
+		opts     MatchOptions
+		text     string
+		rendered string
+	}{
+		{"blackout", MatchOptions{Mode: ModeWords, IgnoreCase: true}, "The BlackOut poem", "███ BlackOut ████"},
+		{"cafe", MatchOptions{Mode: ModeWords, FoldDiacritics: true}, "Au café noir", "██ café ████"},
+		// Decomposed accent in the poem
+		{"cafe", MatchOptions{Mode: ModeWords, FoldDiacritics: true}, "Au cafe\u0301 noir", "██ cafe\u0301 ████"},
+		{"CAFE Noir", MatchOptions{Mode: ModeWords, IgnoreCase: true, FoldDiacritics: true}, "Au Café noir", "██ Café noir"},
+		{"Éclair", MatchOptions{Mode: ModeLetters, IgnoreCase: true, FoldDiacritics: true}, "ECLAIRS", "ECLAIR█"},
+		{"ss", MatchOptions{Mode: ModeLetters, IgnoreCase: true}, "traße", "███ß█"},
+		{"blackout", MatchOptions{Mode: ModeWords}, "The BlackOut poem", ""},
+		{"cafe", MatchOptions{Mode: ModeWords, IgnoreCase: true}, "Au café noir", ""},
+	}
+	for _, test := range tests {
+		matcher, err := newMatcher(test.message, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, ok := matcher.Match(test.text)
+		if test.rendered == "" {
+			if ok {
+				t.Fatalf("Message %q should not match %q with %+v", test.message, test.text, test.opts)
+			}
+			continue
+		}
+		if !ok {
+			t.Fatalf("Message %q should match %q with %+v", test.message, test.text, test.opts)
+		}
+		if rendered := renderBlackout(test.text, spans); rendered != test.rendered {
+			t.Fatalf("Unexpected blackout of %q with %+v: %s", test.text, test.opts, rendered)
+		}
+	}
+}
+
+func TestFoldCounts(t *testing.T) {
+	folder := textFolder{IgnoreCase: true, FoldDiacritics: true}
+	needed := MatchOptions{IgnoreCase: true, FoldDiacritics: true}.neededRunes("Éé e")
+	if !hasRunes(folder.foldCounts(countRunes("eÉE")), needed) {
+		t.Fatal("Folded poem should have enough characters for folded message")
+	}
+	if hasRunes(folder.foldCounts(countRunes("eÉ")), needed) {
+		t.Fatal("Folded poem should not have enough characters for folded message")
+	}
+	// Checking the counts directly agrees with folding them first
+	for _, text := range []string{"eÉE", "eÉ", "EEE", "ee", "éÉè", "KkK"} {
+		for _, opts := range []MatchOptions{{IgnoreCase: true}, {FoldDiacritics: true}, {IgnoreCase: true, FoldDiacritics: true}, {}} {
+			for _, message := range []string{"Éé e", "eee", "kkk"} {
+				needed := opts.neededRunes(message)
+				expected := hasRunes(opts.folder().foldCounts(countRunes(text)), needed)
+				if opts.folder().hasRunes(countRunes(text), needed) != expected {
+					t.Fatalf("Checking %q for %q with %+v should give %t", text, message, opts, expected)
+				}
+			}
+		}
+	}
+}
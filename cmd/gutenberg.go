@@ -0,0 +1,258 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// Ways of splitting a book into passages.
+const (
+	PassagesStanza    = "stanza"    // Each stanza (or paragraph) is a passage.
+	PassagesParagraph = "paragraph" // Whole paragraphs are gathered into passages up to the window size.
+	PassagesWindow    = "window"    // The book is cut into passages of the window size, at the word breaks closest to it.
+)
+
+var (
+	Passages   string // How to split Project Gutenberg books into passages.
+	WindowSize int    // Maximum size of the passages of Project Gutenberg books [characters].
+)
+
+// creditPrefixes start the volunteers' credits that some books have at the start of their text.
+var creditPrefixes = []string{"Produced by", "E-text prepared by", "Transcribed from", "Transcribed by"}
+
+// errNotGutenberg is returned when importing a file without Project Gutenberg's start and end markers.
+var errNotGutenberg = errors.New("No Project Gutenberg start and end markers")
+
+// corpusGutenbergCmd imports the passages of Project Gutenberg books into a corpus.
+var corpusGutenbergCmd = &cobra.Command{
+	Use:   "gutenberg <book.txt>...",
+	Short: "Import the passages of Project Gutenberg plain-text books",
+	Long: `Import the passages of Project Gutenberg plain-text (.txt) books into the corpus
+given by --corpus, making it if it doesn't exist yet. The license header and
+footer are left out, and every passage is credited with the book's title and
+author. Books are split into single stanzas (or paragraphs), into whole
+paragraphs gathered up to the window size, or into windows of the window size
+that are cut at word breaks, even in the middle of a paragraph or line.`,
+	Example: `blackout corpus gutenberg pg1342.txt --passages paragraph --corpus austen
+blackout corpus gutenberg pg1322.txt --passages stanza --corpus whitman`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runGutenberg,
+}
+
+// init sets up the gutenberg sub-command and its flags.
+func init() {
+	corpusGutenbergCmd.Flags().StringVar(&Passages, "passages", PassagesParagraph, "how to split books into passages (\"stanza\", \"paragraph\", or \"window\")")
+	corpusGutenbergCmd.Flags().IntVar(&WindowSize, "window", defaultMaxLength, "maximum passage size [characters], to fit within --max-length")
+	corpusGutenbergCmd.Flags().StringVarP(&ImportAuthor, "author", "a", "Unknown", "author of books without one in their header")
+	corpusCmd.AddCommand(corpusGutenbergCmd)
+}
+
+// runGutenberg runs the `corpus gutenberg` sub-command.
+func runGutenberg(_ *cobra.Command, args []string) {
+	if Passages != PassagesStanza && Passages != PassagesParagraph && Passages != PassagesWindow {
+		fmt.Printf("Unknown passage splitting %q; choose \"%s\", \"%s\" or \"%s\"\n", Passages, PassagesStanza, PassagesParagraph, PassagesWindow)
+		os.Exit(1)
+	}
+	if WindowSize <= 0 {
+		fmt.Println("The passage window size has to be positive")
+		os.Exit(1)
+	}
+	if len(Corpora) != 1 {
+		fmt.Println("Choose a single corpus to import books into with --corpus")
+		os.Exit(1)
+	}
+	corpus, corpusErr := newCorpus(Corpora[0])
+	if corpusErr != nil {
+		fmt.Println(corpusErr)
+		os.Exit(1)
+	}
+	poems := []Poem{}
+	for _, path := range args {
+		contents, readErr := os.ReadFile(path)
+		if readErr == nil && !utf8.Valid(contents) {
+			readErr = fmt.Errorf("%s is not a UTF-8 text file", path)
+		}
+		if readErr != nil {
+			fmt.Printf("Could not read book %s: %s\n", path, readErr)
+			log.Fatal(readErr)
+		}
+		book, bookErr := parseGutenbergBook(string(contents), path, ImportAuthor)
+		if bookErr != nil {
+			fmt.Printf("Could not import book %s: %s\n", path, bookErr)
+			log.Fatal(bookErr)
+		}
+		passages := splitPassages(book.Text, Passages, WindowSize)
+		log.Printf("Importing %d passages of \"%s\" by %s from %s\n", len(passages), book.Title, book.Author, path)
+		for _, passage := range passages {
+			poems = append(poems, Poem{book.Title, book.Author, passage})
+		}
+	}
+	added, addErr := addImportedPoems(poems, corpus.Imports, corpus.Store)
+	if addErr != nil {
+		fmt.Printf("Could not add the imported passages to the %s corpus: %s\n", corpus.Name, addErr)
+		log.Fatal(addErr)
+	}
+	fmt.Printf("Imported %d passages into the %s corpus\n", added, corpus.Name)
+	if added < len(poems) {
+		fmt.Printf("Skipped %d passages that were already imported\n", len(poems)-added)
+	}
+}
+
+// parseGutenbergBook parses a Project Gutenberg plain-text book, returning its title, author, and the text between
+// its license header and footer (with real line breaks). The title and author come from the header's `Title:` and
+// `Author:` lines if it has them, or else the file's name and the given author. Volunteers' credits at the start of the
+// text are left out.
+func parseGutenbergBook(contents string, filePath string, author string) (Poem, error) {
+	contents = strings.ReplaceAll(contents, "\r\n", "\n")
+	contents = strings.TrimPrefix(contents, "\ufeff")
+	lines := strings.Split(contents, "\n")
+	book := Poem{Title: strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)), Author: author}
+	start, end := -1, -1
+	for idx, line := range lines {
+		upper := strings.ToUpper(strings.TrimSpace(line))
+		isMarker := strings.Contains(upper, "PROJECT GUTENBERG") &&
+			(strings.HasPrefix(upper, "***") || strings.HasPrefix(upper, "END OF"))
+		switch {
+		case start < 0 && isMarker && strings.Contains(upper, "START OF"):
+			start = idx + 1
+		case start >= 0 && isMarker && strings.Contains(upper, "END OF"):
+			end = idx
+		case start < 0:
+			// Read the metadata in the header, whose values can continue on indented lines
+			key, value, found := strings.Cut(line, ":")
+			switch {
+			case found && key == "Title":
+				book.Title = strings.TrimSpace(value)
+			case found && key == "Author":
+				book.Author = strings.TrimSpace(value)
+			case idx > 0 && strings.HasPrefix(lines[idx-1], "Title:") && strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "":
+				book.Title += " " + strings.TrimSpace(line)
+			}
+		}
+		if end >= 0 {
+			break
+		}
+	}
+	if start < 0 || end < 0 {
+		return book, errNotGutenberg
+	}
+	// Leave out the volunteers' credits before the book's own text
+	isCredit := func(line string) bool {
+		return slices.ContainsFunc(creditPrefixes, func(prefix string) bool { return strings.HasPrefix(line, prefix) })
+	}
+	for start < end && (strings.TrimSpace(lines[start]) == "" || isCredit(lines[start])) {
+		if !isCredit(lines[start]) {
+			start++
+			continue
+		}
+		for start < end && strings.TrimSpace(lines[start]) != "" {
+			start++
+		}
+	}
+	book.Text = strings.Join(lines[start:end], "\n")
+	return book, nil
+}
+
+// splitPassages splits the text of a book into passages in the given way, in the same format as the poems dataset's
+// texts. Passages are at most the window size in length, unless a single stanza or paragraph is longer.
+func splitPassages(text string, passages string, windowSize int) []string {
+	if passages == PassagesWindow {
+		return windowPassages(text, windowSize)
+	}
+	// Gather the blank-line-separated blocks into passages
+	split := []string{}
+	current := []string{}
+	for _, block := range textBlocks(text) {
+		block = strings.ReplaceAll(block, "\n", "\\n")
+		length := len(strings.Join(append(current, block), "\\n\\n"))
+		if len(current) > 0 && (passages == PassagesStanza || length > windowSize) {
+			split = append(split, strings.Join(current, "\\n\\n"))
+			current = []string{}
+		}
+		current = append(current, block)
+	}
+	if len(current) > 0 {
+		split = append(split, strings.Join(current, "\\n\\n"))
+	}
+	return split
+}
+
+// windowPassages cuts the text into passages of at most the window size, each one ending at the last word break (a
+// space or line break) that fits, so that words are kept whole. Words longer than the window size are cut where it ends.
+func windowPassages(text string, windowSize int) []string {
+	windows := []string{}
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	for text != "" {
+		end, lastBreak, length := len(text), 0, 0
+		for idx, r := range text {
+			size := utf8.RuneLen(r)
+			if r == '\n' {
+				size = len("\\n")
+			}
+			if length+size > windowSize {
+				end = idx
+				break
+			}
+			length += size
+			if unicode.IsSpace(r) {
+				lastBreak = idx
+			}
+		}
+		if next, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && !unicode.IsSpace(next) && lastBreak > 0 {
+			end = lastBreak
+		}
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(text)
+		}
+		window := strings.TrimRightFunc(text[:end], unicode.IsSpace)
+		windows = append(windows, strings.ReplaceAll(window, "\n", "\\n"))
+		text = strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	}
+	return windows
+}
+
+// textBlocks splits the text into its blocks of lines separated by blank lines, like stanzas or paragraphs.
+func textBlocks(text string) []string {
+	blocks := []string{}
+	block := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			block = append(block, strings.TrimRight(line, " \t"))
+			continue
+		}
+		if len(block) > 0 {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = []string{}
+		}
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+	return blocks
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testBook is a short book in the format of Project Gutenberg's plain-text books.
+const testBook = "\ufeffThe Project Gutenberg eBook of Leaves\r\n" +
+	"\r\n" +
+	"Title: Leaves of\r\n" +
+	"       Grass\r\n" +
+	"\r\n" +
+	"Author: Walt Whitman\r\n" +
+	"\r\n" +
+	"*** START OF THE PROJECT GUTENBERG EBOOK LEAVES OF GRASS ***\r\n" +
+	"\r\n" +
+	"Produced by volunteers\r\n" +
+	"and more volunteers\r\n" +
+	"\r\n" +
+	"I celebrate myself,\r\n" +
+	"And what I assume you shall assume.\r\n" +
+	"\r\n" +
+	"\r\n" +
+	"For every atom belonging to me\r\n" +
+	"as good belongs to you.\r\n" +
+	"\r\n" +
+	"*** END OF THE PROJECT GUTENBERG EBOOK LEAVES OF GRASS ***\r\n" +
+	"\r\n" +
+	"The license.\r\n"
+
+func TestParseGutenbergBook(t *testing.T) {
+	book, err := parseGutenbergBook(testBook, "books/pg1322.txt", "Unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Poem{
+		"Leaves of Grass",
+		"Walt Whitman",
+		"I celebrate myself,\nAnd what I assume you shall assume.\n\n\nFor every atom belonging to me\nas good belongs to you.\n",
+	}
+	if book != expected {
+		t.Fatalf("Unexpected book: %+v", book)
+	}
+	// Books without metadata are named after their file
+	book, err = parseGutenbergBook("*** START OF THIS PROJECT GUTENBERG EBOOK ***\nText\nEnd of the Project Gutenberg EBook\n", "books/pg1322.txt", "Unknown")
+	if err != nil || book != (Poem{"pg1322", "Unknown", "Text"}) {
+		t.Fatalf("Unexpected book without metadata: %+v, %v", book, err)
+	}
+	if _, err := parseGutenbergBook("Title: Not a book\n\nText\n", "notes.txt", "Unknown"); err == nil {
+		t.Fatal("Files without the start and end markers should not be imported")
+	}
+}
+
+func TestSplitPassages(t *testing.T) {
+	text := "\nI celebrate myself,\nAnd what I assume you shall assume.\n\n\nFor every atom\nas good belongs to you.\n\nA third\n"
+	tests := []struct {
+		passages   string
+		windowSize int
+		expected   []string
+	}{
+		{PassagesStanza, 400, []string{
+			"I celebrate myself,\\nAnd what I assume you shall assume.",
+			"For every atom\\nas good belongs to you.",
+			"A third",
+		}},
+		{PassagesParagraph, 400, []string{
+			"I celebrate myself,\\nAnd what I assume you shall assume.\\n\\nFor every atom\\nas good belongs to you.\\n\\nA third",
+		}},
+		{PassagesParagraph, 70, []string{
+			"I celebrate myself,\\nAnd what I assume you shall assume.",
+			"For every atom\\nas good belongs to you.\\n\\nA third",
+		}},
+		// Paragraphs longer than the window are kept whole
+		{PassagesParagraph, 10, []string{
+			"I celebrate myself,\\nAnd what I assume you shall assume.",
+			"For every atom\\nas good belongs to you.",
+			"A third",
+		}},
+		{PassagesWindow, 60, []string{
+			"I celebrate myself,\\nAnd what I assume you shall assume.",
+			"For every atom\\nas good belongs to you.\\n\\nA third",
+		}},
+		// Windows are cut at the last word break that fits, even in the middle of a line
+		{PassagesWindow, 30, []string{
+			"I celebrate myself,\\nAnd what",
+			"I assume you shall assume.",
+			"For every atom\\nas good",
+			"belongs to you.\\n\\nA third",
+		}},
+		// Words longer than the window are cut where it ends
+		{PassagesWindow, 6, []string{
+			"I", "celebr", "ate", "myself", ",\\nAnd", "what I", "assume", "you", "shall", "assume", ".", "For", "every",
+			"atom", "as", "good", "belong", "s to", "you.", "A", "third",
+		}},
+	}
+	for _, test := range tests {
+		passages := splitPassages(text, test.passages, test.windowSize)
+		if !slices.Equal(passages, test.expected) {
+			t.Fatalf("Unexpected %s passages with window size %d: %q", test.passages, test.windowSize, passages)
+		}
+		for _, passage := range passages {
+			// Only single lines can be longer than the window
+			if len(passage) > test.windowSize && test.passages == PassagesWindow && strings.Contains(passage, "\\n") {
+				t.Fatalf("Passage is longer than the window size %d: %q", test.windowSize, passage)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// htmlStyle is the stylesheet embedded in every HTML blackout page.
+const htmlStyle = `body {
+  margin: 2em auto;
+  max-width: 60em;
+  padding: 0 1em;
+  background: white;
+  color: black;
+}
+.blackout {
+  margin: 0 0 3em;
+}
+.poem {
+  font-family: "Courier New", Courier, monospace;
+  line-height: 1.5;
+  white-space: pre-wrap;
+}
+.erased {
+  background: black;
+  color: black;
+  -webkit-print-color-adjust: exact;
+  print-color-adjust: exact;
+}
+.attribution {
+  font-style: italic;
+}`
+
+// WriteHTML writes the blackout poems as a standalone HTML page. Erased text is styled as black bars, and each poem is
+// labelled with its hidden message, so that screen readers read out the message instead of the poem's fragments.
+func WriteHTML(w io.Writer, blackouts []Blackout) error {
+	var body strings.Builder
+	messages := []string{}
+	for _, b := range blackouts {
+		messages = append(messages, b.Message)
+		fmt.Fprintf(&body, "<figure class=\"blackout\">\n<pre class=\"poem\" role=\"img\" aria-label=\"%s\">",
+			html.EscapeString(b.Message))
+		for idx, line := range b.Lines() {
+			if idx > 0 {
+				body.WriteString("\n")
+			}
+			for _, run := range line {
+				switch {
+				case run.Kept:
+					fmt.Fprintf(&body, `<span class="kept">%s</span>`, html.EscapeString(run.Text))
+				case run.Erased:
+					fmt.Fprintf(&body, `<span class="erased" aria-hidden="true">%s</span>`, html.EscapeString(run.Text))
+				default:
+					body.WriteString(html.EscapeString(run.Text))
+				}
+			}
+		}
+		fmt.Fprintf(&body, "</pre>\n<figcaption class=\"attribution\">%s</figcaption>\n</figure>\n",
+			html.EscapeString(b.Attribution()))
+	}
+	_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+%s
+</style>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(strings.Join(messages, " ")), htmlStyle, body.String())
+	return err
+}
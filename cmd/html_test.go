@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	poem := NewParsedPoem(Poem{"<Lorem> & Co", "Ipsum", "Dolor <Sit>\\nAmet"})
+	b, err := newBlackout(0, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, []Blackout{b}); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	if !strings.Contains(page, `role="img" aria-label="it me"`) {
+		t.Fatal("The poem should be labelled with its message")
+	}
+	if strings.Count(page, `<span class="erased" aria-hidden="true">`) != 5 {
+		t.Fatalf("Unexpected erased spans: %s", page)
+	}
+	if !strings.Contains(page, `<span class="kept">it</span>`) || !strings.Contains(page, `<span class="kept">me</span>`) {
+		t.Fatalf("Unexpected kept spans: %s", page)
+	}
+	if !strings.Contains(page, "Excerpt of &#34;&lt;Lorem&gt; &amp; Co&#34; by Ipsum") {
+		t.Fatal("The attribution should be escaped")
+	}
+	// Without its markup, the poem should read as its original text
+	pre := regexp.MustCompile(`(?s)<pre[^>]*>(.*)</pre>`).FindStringSubmatch(page)
+	if pre == nil {
+		t.Fatal("The poem should be preformatted")
+	}
+	text := html.UnescapeString(regexp.MustCompile(`<[^>]*>`).ReplaceAllString(pre[1], ""))
+	if text != b.Text {
+		t.Fatalf("Unexpected poem text: %q", text)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"unicode/utf8"
+)
+
+// A BlackoutRecord is the JSON representation of a blackout poem.
+type BlackoutRecord struct {
+	ID       int    // The poem's ID.
+	Title    string // The poem's title.
+	Author   string // The poem's author.
+	Text     string // The poem's original text, with its lines separated by newlines.
+	Blackout string // The blacked out poem, rendered as text.
+	Message  string // The message hidden in the poem.
+	Kept     []Span // The ranges of the text that stay visible, as offsets in characters (Unicode code points).
+	Offset   int    // Where the text starts in the whole poem, if it's a window of a longer poem [characters].
+}
+
+// WriteJSON writes each blackout poem as a JSON object on its own line, rendering its text with the eraser.
+func WriteJSON(w io.Writer, blackouts []Blackout, eraser Eraser) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, b := range blackouts {
+		kept := make([]Span, 0, len(b.Kept))
+		for _, span := range b.Kept {
+			start := utf8.RuneCountInString(b.Text[:span.Start])
+			kept = append(kept, Span{start, start + utf8.RuneCountInString(b.Text[span.Start:span.End])})
+		}
+		record := BlackoutRecord{b.ID, b.Poem.Title, b.Poem.Author, b.Text, b.Render(eraser), b.Message, kept, b.Poem.Offset}
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
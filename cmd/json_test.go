@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem", "Ipsum", "Dolör <Sit>\\nAmet"})
+	b, err := newBlackout(7, poem, "ö it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, []Blackout{b, b}, RuneEraser{'█'}); err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(&buf)
+	for range 2 {
+		var record BlackoutRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record.ID != 7 || record.Title != "Lorem" || record.Author != "Ipsum" || record.Message != "ö it me" {
+			t.Fatalf("Unexpected record: %+v", record)
+		}
+		if record.Text != "Dolör <Sit>\nAmet" || record.Blackout != "███ö█ ██it█\n█me█" {
+			t.Fatalf("Unexpected record text: %+v", record)
+		}
+		// The kept offsets count characters, not bytes
+		runes := []rune(record.Text)
+		kept := ""
+		for _, span := range record.Kept {
+			kept += string(runes[span.Start:span.End])
+		}
+		if kept != "öitme" {
+			t.Fatalf("Unexpected kept characters: %q", kept)
+		}
+	}
+	if decoder.More() {
+		t.Fatal("There should be one record per poem")
+	}
+}
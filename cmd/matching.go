@@ -0,0 +1,467 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// A Span is a range of a poem's delineated text, in bytes.
+type Span struct {
+	Start int // The offset of the span's first byte.
+	End   int // The offset just past the span's last byte.
+}
+
+// A Matcher finds the parts of a poem's delineated text to keep visible when blacking out a message.
+type Matcher interface {
+	// Match returns the spans of the text to keep, and whether the message can be blacked out of the text at all.
+	Match(text string) ([]Span, bool)
+}
+
+// subsequenceMatcher keeps the earliest letters of the poem that spell out the message in order. With the message's
+// punctuation required and no word breaks, it keeps the same letters as a lazy regex with a capture group for each
+// character, but scans the text only once and has no limit on the message's length. Unlike the regex, it only keeps whole user-perceived characters,
+// so a bare "e" of the message never keeps the "e" of an "é" written with a combining accent.
+type subsequenceMatcher struct {
+	units []messageUnit // The message's characters.
+}
+
+// Match returns the spans of the earliest letters of the text that spell out the message.
+func (sm subsequenceMatcher) Match(text string) ([]Span, bool) {
+	spans, ok := placeUnits(text, graphemeBoundaries(text), sm.units, 0, false, false)
+	if !ok {
+		return nil, false
+	}
+	return mergeSpans(spans), true
+}
+
+// wordsMatcher keeps the earliest whole words of the poem that spell out the message's words in order.
+type wordsMatcher struct {
+	words      []messageWord // The message's words.
+	wordBreaks bool          // Whether kept words have to be separated by whitespace.
+}
+
+// Match returns the spans of the earliest whole words of the text that spell out the message's words.
+func (wm wordsMatcher) Match(text string) ([]Span, bool) {
+	spans := []Span{}
+	pos := 0
+	for idx, word := range wm.words {
+		from := pos
+		if wm.wordBreaks && len(spans) > 0 {
+			from = nextBreak(text, pos)
+		}
+		placed := false
+		for alt, spelling := range word.Texts {
+			if from < 0 {
+				break
+			}
+			start := indexWholeWord(text, spelling, from)
+			if start < 0 {
+				continue
+			}
+			// Keep the more faithful spellings only if the rest of the message still fits after them
+			if (alt < len(word.Texts)-1 || word.Optional) && !wm.fits(text, wm.words[idx+1:], start+len(spelling)) {
+				continue
+			}
+			spans = append(spans, Span{start, start + len(spelling)})
+			pos = start + len(spelling)
+			placed = true
+			break
+		}
+		if !placed && !word.Optional {
+			return nil, false
+		}
+	}
+	return spans, true
+}
+
+// fits signals whether the least faithful spellings of the required words appear in order as whole words in the text
+// after the given position, which comes just after a kept word.
+func (wm wordsMatcher) fits(text string, words []messageWord, pos int) bool {
+	for _, word := range words {
+		if word.Optional {
+			continue
+		}
+		if wm.wordBreaks {
+			if pos = nextBreak(text, pos); pos < 0 {
+				return false
+			}
+		}
+		spelling := word.Texts[len(word.Texts)-1]
+		start := indexWholeWord(text, spelling, pos)
+		if start < 0 {
+			return false
+		}
+		pos = start + len(spelling)
+	}
+	return true
+}
+
+// mixedMatcher places each message word as a whole word if it can, then as a substring, then as scattered letters.
+type mixedMatcher struct {
+	words      []messageWord // The message's words.
+	wordBreaks bool          // Whether kept words have to be separated by whitespace.
+}
+
+// Match greedily places the message's words in order, choosing the most readable placement for each word that still
+// leaves room for the rest of the message.
+func (mm mixedMatcher) Match(text string) ([]Span, bool) {
+	// Flatten the words' characters, so that the rest of the message can be spelled out after any word
+	units := []messageUnit{}
+	starts := make([]int, 0, len(mm.words)+1)
+	for _, word := range mm.words {
+		starts = append(starts, len(units))
+		units = append(units, word.Units...)
+	}
+	starts = append(starts, len(units))
+	bounds := graphemeBoundaries(text)
+	spans := []Span{}
+	pos := 0
+	for idx, word := range mm.words {
+		rest := units[starts[idx+1]:]
+		from := pos
+		if mm.wordBreaks && len(spans) > 0 {
+			from = nextBreak(text, pos)
+		}
+		if start, end := mm.placeWord(text, bounds, word, rest, from); start >= 0 {
+			spans = append(spans, Span{start, end})
+			pos = end
+			continue
+		}
+		letterSpans, ok := placeUnits(text, bounds, units[starts[idx]:], pos, len(spans) > 0, false)
+		if !ok {
+			return nil, false
+		}
+		for _, span := range letterSpans[:len(word.Units)] {
+			if span.Start < span.End {
+				spans = append(spans, span)
+				pos = span.End
+			}
+		}
+	}
+	return mergeSpans(spans), true
+}
+
+// placeWord finds the earliest whole word, or failing that the earliest substring, of the text at or after the given
+// position that spells out the word and leaves room for the rest of the message's characters. It returns the start
+// and end of the placement, or -1 for both if there is none.
+func (mm mixedMatcher) placeWord(text string, bounds graphemeBounds, word messageWord, rest []messageUnit, from int) (int, int) {
+	if from < 0 {
+		return -1, -1
+	}
+	index := func(spelling string) int {
+		return indexGraphemes(text, bounds, spelling, from)
+	}
+	for _, indexSpelling := range []func(string) int{
+		func(spelling string) int { return indexWholeWord(text, spelling, from) },
+		index,
+	} {
+		for _, spelling := range word.Texts {
+			start := indexSpelling(spelling)
+			if start < 0 {
+				continue
+			}
+			if _, ok := placeUnits(text, bounds, rest, start+len(spelling), true, true); ok {
+				return start, start + len(spelling)
+			}
+		}
+	}
+	return -1, -1
+}
+
+// lineMatcher keeps each part of the message on its own line of the poem, in order.
+type lineMatcher struct {
+	parts []Matcher // The matchers for the message's parts, one line each.
+}
+
+// Match places each part of the message on the earliest line after the previous part's line that it can be blacked
+// out of, and returns the spans of all the parts.
+func (lm lineMatcher) Match(text string) ([]Span, bool) {
+	spans := []Span{}
+	start := 0
+	for _, part := range lm.parts {
+		for {
+			if start > len(text) {
+				return nil, false
+			}
+			end := strings.IndexByte(text[start:], '\n')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += start
+			}
+			lineSpans, ok := part.Match(text[start:end])
+			lineStart := start
+			start = end + 1
+			if ok {
+				for _, span := range lineSpans {
+					spans = append(spans, Span{lineStart + span.Start, lineStart + span.End})
+				}
+				break
+			}
+		}
+	}
+	return spans, true
+}
+
+// messageParts splits the message into the parts that go on separate lines of the poem: its lines if it has several,
+// or else its words.
+func messageParts(message string) []string {
+	if !strings.Contains(message, "\n") {
+		return strings.Fields(message)
+	}
+	parts := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.TrimSpace(line) != "" {
+			parts = append(parts, line)
+		}
+	}
+	return parts
+}
+
+// isWordRune signals whether the given rune can be part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// isWholeWord signals whether the given span of the text is not directly surrounded by other word characters.
+func isWholeWord(text string, span Span) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:span.Start])
+	after, _ := utf8.DecodeRuneInString(text[span.End:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+// indexWholeWord returns the offset of the first occurrence of the word as a whole word in the text at or after the
+// given position, or -1 if there is none.
+func indexWholeWord(text string, word string, pos int) int {
+	for pos <= len(text) {
+		idx := strings.Index(text[pos:], word)
+		if idx < 0 {
+			return -1
+		}
+		start := pos + idx
+		if isWholeWord(text, Span{start, start + len(word)}) {
+			return start
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		pos = start + size
+	}
+	return -1
+}
+
+// indexGraphemes returns the offset of the first occurrence of the characters in the text at or after the given
+// position that starts and ends on the text's grapheme boundaries, or -1 if there is none. This keeps a bare letter of
+// the message from matching the start of a letter with combining marks in the text.
+func indexGraphemes(text string, bounds graphemeBounds, chars string, pos int) int {
+	for pos <= len(text) {
+		idx := strings.Index(text[pos:], chars)
+		if idx < 0 {
+			return -1
+		}
+		start := pos + idx
+		if bounds.at(start) && bounds.at(start+len(chars)) {
+			return start
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		pos = start + size
+	}
+	return -1
+}
+
+// graphemeBounds marks the offsets of a text that fall between two of its user-perceived characters. A nil
+// graphemeBounds marks every offset, as in ASCII text without "\r\n" line breaks.
+type graphemeBounds []bool
+
+// graphemeBoundaries walks the user-perceived characters of the text once, and marks the offsets between them.
+func graphemeBoundaries(text string) graphemeBounds {
+	isASCII := !strings.Contains(text, "\r\n")
+	for idx := 0; idx < len(text) && isASCII; idx++ {
+		isASCII = text[idx] < utf8.RuneSelf
+	}
+	if isASCII {
+		return nil
+	}
+	bounds := make(graphemeBounds, len(text)+1)
+	bounds[0] = true
+	state, pos := -1, 0
+	for rest := text; rest != ""; {
+		var char string
+		char, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		pos += len(char)
+		bounds[pos] = true
+	}
+	return bounds
+}
+
+// at signals whether the offset falls between two user-perceived characters of the text.
+func (gb graphemeBounds) at(pos int) bool {
+	return gb == nil || gb[pos]
+}
+
+// A messageUnit is a character of the message to keep in a poem.
+type messageUnit struct {
+	Text      string // The character.
+	Optional  bool   // Whether the character is kept only when the rest of the message still fits after it.
+	WordStart bool   // Whether the character starts a word, and so has to come after whitespace in the poem.
+}
+
+// A messageWord is a word of the message to keep in a poem.
+type messageWord struct {
+	Texts    []string      // The ways to spell the word, from the most to the least faithful to the message.
+	Optional bool          // Whether the word is only punctuation that can be left out.
+	Units    []messageUnit // The word's characters, for spelling it out with scattered letters.
+}
+
+// letterUnits splits the message into its non-whitespace characters, handling punctuation as given. With word breaks,
+// the first character of every word is marked as a word start.
+func letterUnits(message string, punctuation string, wordBreaks bool) []messageUnit {
+	units := []messageUnit{}
+	wordStart := wordBreaks
+	for _, char := range graphemes(message) {
+		if isSpace(char) {
+			wordStart = wordBreaks
+			continue
+		}
+		optional := false
+		if isPunct(char) {
+			switch punctuation {
+			case PunctuationIgnore:
+				continue
+			case PunctuationOptional:
+				optional = true
+			}
+		}
+		units = append(units, messageUnit{char, optional, wordStart})
+		wordStart = false
+	}
+	return units
+}
+
+// messageWords splits the message into its words, handling punctuation as given. Ignored punctuation is removed from
+// words, even inside them like the apostrophe of "don't", and optional punctuation at the ends of words is kept only
+// where the poem allows it.
+func messageWords(message string, punctuation string, wordBreaks bool) []messageWord {
+	words := []messageWord{}
+	for _, field := range strings.Fields(message) {
+		bare := strings.TrimFunc(field, unicode.IsPunct)
+		word := messageWord{[]string{field}, false, letterUnits(field, punctuation, wordBreaks)}
+		switch {
+		case punctuation == PunctuationIgnore && bare == "":
+			continue
+		case punctuation == PunctuationIgnore:
+			word.Texts = []string{strings.Join(strings.FieldsFunc(bare, unicode.IsPunct), "")}
+		case punctuation == PunctuationOptional && bare == "":
+			word.Optional = true
+		case punctuation == PunctuationOptional && bare != field:
+			word.Texts = append(word.Texts, bare)
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// placeUnits finds the earliest placement of the characters in the text at or after the given position, and returns
+// one span per character. Optional characters are kept only if the required characters after them still fit, and are
+// given an empty span otherwise (or always, when skipping optional characters). A character starting a word has to
+// come after whitespace, unless nothing has been placed before it.
+func placeUnits(text string, bounds graphemeBounds, units []messageUnit, pos int, placed bool, skipOptional bool) ([]Span, bool) {
+	spans := make([]Span, 0, len(units))
+	wordStart := false
+	for idx, unit := range units {
+		wordStart = wordStart || unit.WordStart
+		if unit.Optional && skipOptional {
+			spans = append(spans, Span{pos, pos})
+			continue
+		}
+		start, from := -1, pos
+		if wordStart && placed {
+			from = nextBreak(text, pos)
+		}
+		if from >= 0 {
+			start = indexGraphemes(text, bounds, unit.Text, from)
+		}
+		if start >= 0 && unit.Optional {
+			if _, ok := placeUnits(text, bounds, units[idx+1:], start+len(unit.Text), true, true); !ok {
+				start = -1
+			}
+		}
+		if start < 0 {
+			if !unit.Optional {
+				return nil, false
+			}
+			spans = append(spans, Span{pos, pos})
+			continue
+		}
+		spans = append(spans, Span{start, start + len(unit.Text)})
+		pos = start + len(unit.Text)
+		placed, wordStart = true, false
+	}
+	return spans, true
+}
+
+// nextBreak returns the offset of the first whitespace in the text at or after the given position, or -1 if there is
+// none.
+func nextBreak(text string, pos int) int {
+	idx := strings.IndexFunc(text[pos:], unicode.IsSpace)
+	if idx < 0 {
+		return -1
+	}
+	return pos + idx
+}
+
+// graphemes splits the text into user-perceived characters (extended grapheme clusters).
+func graphemes(text string) []string {
+	chars := []string{}
+	state := -1
+	for len(text) > 0 {
+		var char string
+		char, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		chars = append(chars, char)
+	}
+	return chars
+}
+
+// isSpace signals whether the character is made up entirely of whitespace.
+func isSpace(char string) bool {
+	return strings.TrimSpace(char) == ""
+}
+
+// isPunct signals whether the character is made up entirely of punctuation.
+func isPunct(char string) bool {
+	return strings.TrimFunc(char, unicode.IsPunct) == ""
+}
+
+// mergeSpans joins spans that directly follow one another, and drops empty ones.
+func mergeSpans(spans []Span) []Span {
+	merged := []Span{}
+	for _, span := range spans {
+		if span.Start == span.End {
+			continue
+		}
+		if len(merged) > 0 && merged[len(merged)-1].End == span.Start {
+			merged[len(merged)-1].End = span.End
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// regexMatcher matches poems with a blackout regex, keeping the text of every even-numbered capture group.
+type regexMatcher struct {
+	rp *regexp.Regexp // The blackout regex pointer.
+}
+
+// Match returns the spans of the blackout regex's kept capture groups.
+func (rm regexMatcher) Match(text string) ([]Span, bool) {
+	loc := rm.rp.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return nil, false
+	}
+	spans := []Span{}
+	for group := 2; 2*group+1 < len(loc); group += 2 {
+		start, end := loc[2*group], loc[2*group+1]
+		if start >= 0 && start < end {
+			spans = append(spans, Span{start, end})
+		}
+	}
+	return mergeSpans(spans), true
+}
+
+func TestRegexMatcherSpans(t *testing.T) {
+	rp := regexp.MustCompile(msg2regex("oit"))
+	spans, ok := regexMatcher{rp}.Match("Dolor Sit Amet")
+	if !ok {
+		t.Fatal("Regex matcher should match")
+	}
+	expected := []Span{{1, 2}, {7, 9}}
+	if len(spans) != len(expected) {
+		t.Fatalf("Unexpected spans: %v", spans)
+	}
+	for idx, span := range spans {
+		if span != expected[idx] {
+			t.Fatalf("Unexpected spans: %v", spans)
+		}
+	}
+}
+
+func TestMixedMatcher(t *testing.T) {
+	text := "a lorem ipsum dolor sitting amet"
+	tests := []struct {
+		message    string
+		rendered   string
+		wholeWords int
+	}{
+		{"lorem amet", "█ lorem █████ █████ ███████ amet", 2},
+		{"sit amet", "█ █████ █████ █████ sit████ amet", 1},
+		{"lid amet", "█ l████ i████ d████ ███████ amet", 1},
+		{"dolor lorem", "", 0},
+	}
+	for _, test := range tests {
+		spans, ok := mixedMatcher{[]messageWord{}, false}.Match(text)
+		if !ok || len(spans) != 0 {
+			t.Fatal("Empty messages should match without keeping anything")
+		}
+		matcher, err := newMatcher(test.message, MatchOptions{Mode: ModeMixed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, ok = matcher.Match(text)
+		if test.rendered == "" {
+			if ok {
+				t.Fatalf("Message %q should not match", test.message)
+			}
+			continue
+		}
+		if !ok {
+			t.Fatalf("Message %q should match", test.message)
+		}
+		if rendered := renderBlackout(text, spans); rendered != test.rendered {
+			t.Fatalf("Unexpected blackout for %q: %s", test.message, rendered)
+		}
+		if hits := wholeWords(text, spans); hits != test.wholeWords {
+			t.Fatalf("Unexpected whole words for %q: %d", test.message, hits)
+		}
+	}
+}
+
+func TestSubsequenceMatcher(t *testing.T) {
+	text := "Dolor Sit Amet"
+	spans, ok := subsequenceMatcher{letterUnits("oS it", PunctuationRequire, false)}.Match(text)
+	if !ok || renderBlackout(text, spans) != "█o███ Sit ████" {
+		t.Fatalf("Unexpected blackout: %s", renderBlackout(text, spans))
+	}
+	_, ok = subsequenceMatcher{letterUnits("tS", PunctuationRequire, false)}.Match(text)
+	if ok {
+		t.Fatal("Out-of-order message should not match")
+	}
+	long := strings.Repeat("lorem ipsum ", 2000)
+	_, ok = subsequenceMatcher{letterUnits(long, PunctuationRequire, false)}.Match(long)
+	if !ok {
+		t.Fatal("Long messages should match themselves")
+	}
+}
+
+func TestUnicodeMessages(t *testing.T) {
+	tests := []struct {
+		message  string
+		text     string
+		rendered string
+	}{
+		{"мир", "Мой мир", "███ мир"},
+		{"λόγος", "ὁ λόγος ἦν", "█ λόγος ██"},
+		{"はな", "はるのはな", "は███な"},
+		{"कि", "कविता किताब", "█████ कि███"},
+		{"שָׁלוֹם", "שָׁלוֹם עֲלֵיכֶם", "שָׁלוֹם ████████"},
+		{"👩‍👩‍👧", "👩 and 👩‍👩‍👧", "█ ███ 👩‍👩‍👧"},
+		{"🇫🇷", "🇩🇪 🇫🇷", "██ 🇫🇷"},
+		{"a\u00a0b\u3000c", "a b c", "a b c"},
+		{"(a).[b]", "x(a).[b]x", "█(a).[b]█"},
+	}
+	for _, test := range tests {
+		rp, err := regexp.Compile(msg2regex(test.message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		regexSpans, regexOK := regexMatcher{rp}.Match(test.text)
+		spans, ok := subsequenceMatcher{letterUnits(test.message, PunctuationRequire, false)}.Match(test.text)
+		if !ok || !regexOK || !slices.Equal(spans, regexSpans) {
+			t.Fatalf("Matchers disagree on %q: %v, %t; %v, %t", test.message, spans, ok, regexSpans, regexOK)
+		}
+		if rendered := renderBlackout(test.text, spans); rendered != test.rendered {
+			t.Fatalf("Unexpected blackout for %q: %s", test.message, rendered)
+		}
+	}
+	// A character with a combining mark must not match the bare character
+	if _, ok := (subsequenceMatcher{letterUnits("कि", PunctuationRequire, false)}).Match("क"); ok {
+		t.Fatal("Partial grapheme clusters should not match")
+	}
+}
+
+func TestPunctuationAndWordBreaks(t *testing.T) {
+	tests := []struct {
+		message  string
+		opts     MatchOptions
+		text     string
+		rendered string
+	}{
+		{"don't stop.", MatchOptions{Mode: ModeLetters}, "dont stop", ""},
+		{"don't stop.", MatchOptions{Mode: ModeLetters, Punctuation: PunctuationIgnore}, "don't stop.", "don█t stop█"},
+		{"don't stop.", MatchOptions{Mode: ModeLetters, Punctuation: PunctuationOptional}, "dont stop", "dont stop"},
+		{"don't stop.", MatchOptions{Mode: ModeLetters, Punctuation: PunctuationOptional}, "don't stop", "don't stop"},
+		{"a.b", MatchOptions{Mode: ModeLetters, Punctuation: PunctuationOptional}, "a b.", "a b█"},
+		{"ab cd", MatchOptions{Mode: ModeLetters}, "abcd ab cd", "abcd ██ ██"},
+		{"ab cd", MatchOptions{Mode: ModeLetters, WordBreaks: true}, "abcd ab cd", "ab██ ██ cd"},
+		{"ab cd", MatchOptions{Mode: ModeLetters, WordBreaks: true}, "abcd", ""},
+		{"stop.", MatchOptions{Mode: ModeWords}, "stop now", ""},
+		{"stop.", MatchOptions{Mode: ModeWords, Punctuation: PunctuationOptional}, "stop now stop.", "████ ███ stop."},
+		{"stop. now", MatchOptions{Mode: ModeWords, Punctuation: PunctuationOptional}, "stop now stop.", "stop now █████"},
+		{"stop -", MatchOptions{Mode: ModeWords, Punctuation: PunctuationOptional}, "stop now", "stop ███"},
+		{"stop -", MatchOptions{Mode: ModeWords, Punctuation: PunctuationIgnore}, "stop - now", "stop █ ███"},
+		{"don't stop", MatchOptions{Mode: ModeWords, Punctuation: PunctuationIgnore}, "dont you stop", "dont ███ stop"},
+		{"don't stop", MatchOptions{Mode: ModeMixed, Punctuation: PunctuationIgnore}, "dont you stop", "dont ███ stop"},
+		{"sit amet", MatchOptions{Mode: ModeWords, WordBreaks: true}, "sit-amet sit amet", "sit█████ ███ amet"},
+		{"don't stop.", MatchOptions{Mode: ModeMixed, Punctuation: PunctuationOptional}, "don't you stop", "don't ███ stop"},
+		{"ab cd", MatchOptions{Mode: ModeMixed, WordBreaks: true}, "abcd ab cd", "████ ab cd"},
+	}
+	for _, test := range tests {
+		matcher, err := newMatcher(test.message, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, ok := matcher.Match(test.text)
+		if ok != (test.rendered != "") {
+			t.Fatalf("Unexpected match for %q in %q with %+v: %t", test.message, test.text, test.opts, ok)
+		}
+		if rendered := renderBlackout(test.text, spans); ok && rendered != test.rendered {
+			t.Fatalf("Unexpected blackout for %q with %+v: %s", test.message, test.opts, rendered)
+		}
+	}
+	if _, err := newMatcher("stop.", MatchOptions{Mode: ModeLetters, Punctuation: "sometimes"}); err == nil {
+		t.Fatal("Unknown punctuation handling should return an error")
+	}
+	needed := MatchOptions{Punctuation: PunctuationOptional}.neededRunes("don't stop.")
+	if needed['\''] != 0 || needed['.'] != 0 || needed['o'] != 2 {
+		t.Fatalf("Unexpected needed runes: %v", needed)
+	}
+}
+
+func TestLineMatcher(t *testing.T) {
+	text := "the black cat\nsat on the mat\nat night"
+	tests := []struct {
+		message  string
+		opts     MatchOptions
+		rendered string
+	}{
+		{"black sat night", MatchOptions{Mode: ModeWords, Lines: true}, "███ black ███\nsat ██ ███ ███\n██ night"},
+		{"cat mat", MatchOptions{Mode: ModeLetters, Lines: true}, "███ ███c█ █at\n███ ██ ███ mat\n██ █████"},
+		{"on the\nat", MatchOptions{Mode: ModeWords, Lines: true}, "███ █████ ███\n███ on the ███\nat █████"},
+		{"on the\n\nat", MatchOptions{Mode: ModeWords, Lines: true}, "███ █████ ███\n███ on the ███\nat █████"},
+		{"cat black", MatchOptions{Mode: ModeWords, Lines: true}, ""},
+		{"the black cat sat", MatchOptions{Mode: ModeWords, Lines: true}, ""},
+		{"BLACK MAT", MatchOptions{Mode: ModeMixed, IgnoreCase: true, Lines: true}, "███ black ███\n███ ██ ███ mat\n██ █████"},
+	}
+	for _, test := range tests {
+		matcher, err := newMatcher(test.message, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, ok := matcher.Match(text)
+		if ok != (test.rendered != "") {
+			t.Fatalf("Unexpected match for %q: %t", test.message, ok)
+		}
+		if rendered := renderBlackout(text, spans); ok && rendered != test.rendered {
+			t.Fatalf("Unexpected blackout for %q: %s", test.message, rendered)
+		}
+	}
+}
+
+func FuzzSubsequenceMatcher(f *testing.F) {
+	f.Add("blackout poem", "The black cat sat\non the mat at night\nand out came the poem")
+	f.Add("oit", "Dolor Sit Amet")
+	f.Add("a.b*c", "a+b.c*c")
+	f.Add("", "lorem ipsum")
+	f.Add("кот\u3000и", "Кот и пёс")
+	f.Add("👩‍👩‍👧 🇫🇷", "a 👩‍👩‍👧 in 🇫🇷")
+	f.Add("e", "cafe\u0301")
+	f.Fuzz(func(t *testing.T, message string, text string) {
+		if !utf8.ValidString(message) || !utf8.ValidString(text) {
+			t.Skip("poems and messages are valid UTF-8")
+		}
+		rp, err := regexp.Compile(msg2regex(message))
+		if err != nil {
+			t.Skip("the message is too long for a regex")
+		}
+		regexSpans, regexOK := regexMatcher{rp}.Match(text)
+		spans, ok := subsequenceMatcher{letterUnits(message, PunctuationRequire, false)}.Match(text)
+		// The regex can keep part of a character with combining marks, which the subsequence matcher never does
+		bounds := graphemeBoundaries(text)
+		splitsGraphemes := func(span Span) bool { return !bounds.at(span.Start) || !bounds.at(span.End) }
+		if slices.ContainsFunc(regexSpans, splitsGraphemes) {
+			if slices.ContainsFunc(spans, splitsGraphemes) {
+				t.Fatalf("Subsequence matcher kept part of a character: %v", spans)
+			}
+			return
+		}
+		if ok != regexOK || !slices.Equal(spans, regexSpans) {
+			t.Fatalf("Subsequence matcher got %v, %t; regex matcher got %v, %t", spans, ok, regexSpans, regexOK)
+		}
+	})
+}
+
+func TestMatchesKeepGraphemesWhole(t *testing.T) {
+	// The poem's "é" is decomposed into "e" and a combining acute accent
+	text := "café or tea"
+	for _, mode := range []string{ModeLetters, ModeMixed} {
+		matcher, err := newMatcher("e", MatchOptions{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans, ok := matcher.Match(text)
+		if !ok || !slices.Equal(spans, []Span{{len("café or t"), len("café or te")}}) {
+			t.Fatalf("Unexpected %s spans of a bare letter: %v, %t", mode, spans, ok)
+		}
+	}
+	matcher, err := newMatcher("é", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans, ok := matcher.Match(text); !ok || !slices.Equal(spans, []Span{{3, len("café")}}) {
+		t.Fatalf("Unexpected spans of a decomposed letter: %v, %t", spans, ok)
+	}
+	if bounds := graphemeBoundaries(text); bounds.at(4) || !bounds.at(3) || !bounds.at(len(text)) || graphemeBoundaries("tea") != nil {
+		t.Fatal("Unexpected grapheme boundaries")
+	}
+}
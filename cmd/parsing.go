@@ -27,7 +27,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/adrg/xdg"
 )
@@ -40,10 +41,16 @@ var (
 	poemsSha256 = [32]byte{0x17, 0x2c, 0xd2, 0xc5, 0xd9, 0x53, 0xc7, 0x02, 0x33, 0x90, 0xa8, 0xd1, 0xf3, 0x37, 0xd0, 0x23, 0xd7, 0xfb, 0xb2, 0xb9, 0x25, 0xdf, 0x0a, 0x66, 0xd0, 0x22, 0x1f, 0x30, 0xc6, 0xad, 0xc3, 0x08}
 	// dataFolder is this program's data folder. On Linux systems, it would be `~/.local/share/blackout`.
 	dataFolder = filepath.Join(xdg.DataHome, "blackout")
-	// Local path to public domain poetry dataset JSON file.
-	dataFolderJSON = filepath.Join(dataFolder, "poems.json")
-	// Directory where the parsed poem JSONs are stored.
-	dataFolderPoems = filepath.Join(dataFolder, "poems")
+	// dataFolderCorpora is the folder with one sub-folder per named corpus of poems.
+	dataFolderCorpora = filepath.Join(dataFolder, "corpora")
+	// Local path where older versions of this program stored the public domain poetry dataset JSON file.
+	legacyFolderJSON = filepath.Join(dataFolder, "poems.json")
+	// Local path where older versions of this program stored the poem store file.
+	legacyFolderStore = filepath.Join(dataFolder, "poems.store")
+	// Local path where older versions of this program stored the poems imported from local files.
+	legacyFolderImports = filepath.Join(dataFolder, "imported.json")
+	// Directory where older versions of this program stored one JSON file per parsed poem.
+	legacyFolderPoems = filepath.Join(dataFolder, "poems")
 )
 
 // poemsBytesHashMatches returns an error if the given byte array's SHA256 hash doesn't match the hard-coded one above.
@@ -111,64 +118,210 @@ func downloadPoemsJSON(poemsPath string) error {
 	return fileErr
 }
 
-// poemFilename returns the poem's file name by its ID.
-func poemFilename(poemID int) string {
-	return "poem" + strconv.Itoa(poemID) + ".json"
+// parsePoems parses an array of poems, and writes them all to the poem store at the given path.
+func parsePoems(poems []Poem, storePath string) error {
+	log.Printf("Parsing %d poems into poem store %s\n", len(poems), storePath)
+	parsedPoems := make([]ParsedPoem, len(poems))
+	for idx, poem := range poems {
+		parsedPoems[idx] = NewParsedPoem(poem)
+	}
+	return writePoemStore(parsedPoems, storePath)
 }
 
-// Parse an array of poems, and split them into JSON files in the poems folder.
-func parsePoems(poems []Poem, poemsFolder string) error {
-	_, folderErr := os.Stat(poemsFolder)
-	if os.IsNotExist(folderErr) {
-		log.Printf("Creating poems folder %s\n", poemsFolder)
-		dirErr := os.Mkdir(poemsFolder, 0o750)
-		if dirErr != nil {
-			return dirErr
-		}
-	} else {
-		log.Printf("Poems folder %s already exists\n", poemsFolder)
-		return nil
+// setupDataFolder sets up this CLI application's data folder, and opens the poem stores of the named corpora. If the
+// window size is positive, then it opens the corpora's poem stores with the poems cut into windows of that size instead.
+func setupDataFolder(corpusNames []string, windowSize int) (PoemStores, error) {
+	setupErr := setupCorporaFolder()
+	if setupErr != nil {
+		return nil, setupErr
 	}
-	for idx, poem := range poems {
-		parsedPoem := NewParsedPoem(poem)
-		poemJSON := filepath.Join(poemsFolder, poemFilename(idx))
-		poemErr := parsedPoem2json(parsedPoem, poemJSON)
-		if poemErr != nil {
-			return poemErr
+	stores := PoemStores{}
+	for _, name := range corpusNames {
+		corpus, corpusErr := newCorpus(name)
+		if corpusErr != nil {
+			return nil, corpusErr
+		}
+		store, storeErr := setupCorpus(corpus)
+		if storeErr == nil && windowSize > 0 {
+			store, storeErr = setupWindowStore(corpus, store, windowSize)
 		}
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		log.Printf("Corpus %s has %d poems\n", corpus.Name, store.Len())
+		stores = append(stores, store)
 	}
-	return nil
+	return stores, nil
 }
 
-// setupDataFolder sets up this CLI application's data folder.
-func setupDataFolder() error {
-	// Make the data folder if it doesn't already exist
+// setupCorporaFolder makes the data folder and its corpora folder if they don't already exist, and moves the files of
+// older versions of this program into the public domain corpus.
+func setupCorporaFolder() error {
 	_, folderErr := os.Stat(dataFolder)
 	if os.IsNotExist(folderErr) {
 		log.Printf("Creating data folder %s\n", dataFolder)
-		dirErr := os.Mkdir(dataFolder, 0o750)
-		if dirErr != nil {
-			return dirErr
-		}
 	} else {
 		log.Printf("Data folder %s already exists\n", dataFolder)
 	}
-	// Download the poem database, and put it in the data folder
-	dlErr := downloadPoemsJSON(dataFolderJSON)
-	if dlErr != nil {
-		return dlErr
+	dirErr := os.MkdirAll(dataFolderCorpora, 0o750)
+	if dirErr != nil {
+		return dirErr
 	}
-	// Populate the "poems" folder in the data folder if not already done
-	_, poemsFolderErr := os.Stat(filepath.Join(dataFolder, "poems"))
-	if os.IsNotExist(poemsFolderErr) {
-		poems, readErr := readPoemsJSON(filepath.Join(dataFolder, "poems.json"))
-		if readErr != nil {
-			return readErr
+	// Keep the downloaded dataset & the imported poems of older versions
+	publicDomain, _ := newCorpus(publicDomainCorpus)
+	moves := [][2]string{{legacyFolderJSON, publicDomain.JSON}, {legacyFolderImports, publicDomain.Imports}}
+	for _, move := range moves {
+		legacyPath, corpusPath := move[0], move[1]
+		_, legacyErr := os.Stat(legacyPath)
+		_, corpusErr := os.Stat(corpusPath)
+		if legacyErr != nil || !os.IsNotExist(corpusErr) {
+			continue
+		}
+		log.Printf("Moving %s into the %s corpus\n", legacyPath, publicDomain.Name)
+		mkdirErr := os.MkdirAll(publicDomain.Folder, 0o750)
+		if mkdirErr != nil {
+			return mkdirErr
 		}
-		splitErr := parsePoems(poems, filepath.Join(dataFolder, "poems"))
-		if splitErr != nil {
-			return splitErr
+		renameErr := os.Rename(legacyPath, corpusPath)
+		if renameErr != nil {
+			return renameErr
+		}
+	}
+	// Clean up the poem store & per-poem JSON files from older versions
+	for _, legacyPath := range []string{legacyFolderStore, legacyFolderPoems} {
+		_, legacyErr := os.Stat(legacyPath)
+		if legacyErr == nil {
+			log.Printf("Removing legacy poems file %s\n", legacyPath)
+			removeErr := os.RemoveAll(legacyPath)
+			if removeErr != nil {
+				return removeErr
+			}
 		}
 	}
 	return nil
 }
+
+// setupCorpus opens the corpus's poem store, building it first if needed. The public domain corpus's poem store is
+// built from the downloaded poetry dataset along with the poems imported into it, and the other corpora's poem stores
+// only from their imported poems.
+func setupCorpus(corpus Corpus) (*PoemStore, error) {
+	poems := []Poem{}
+	if corpus.Name == publicDomainCorpus {
+		// Download the poem database, and put it in the corpus folder
+		dlErr := downloadPoemsJSON(corpus.JSON)
+		if dlErr != nil {
+			return nil, dlErr
+		}
+	} else if _, folderErr := os.Stat(corpus.Folder); os.IsNotExist(folderErr) {
+		return nil, fmt.Errorf("Corpus %s doesn't exist; import poems into it with `blackout corpus import <path> --corpus %s`", corpus.Name, corpus.Name)
+	}
+	// Build the poem store in the corpus folder if not already done
+	store, storeErr := openPoemStore(corpus.Store)
+	if storeErr == nil {
+		return store, nil
+	}
+	if !os.IsNotExist(storeErr) {
+		log.Printf("Rebuilding poem store: %s\n", storeErr)
+	}
+	if corpus.Name == publicDomainCorpus {
+		dataset, readErr := readPoemsJSON(corpus.JSON)
+		if readErr != nil {
+			return nil, readErr
+		}
+		poems = append(poems, dataset...)
+	}
+	imported, importsErr := readImportedPoems(corpus.Imports)
+	if importsErr != nil {
+		return nil, importsErr
+	}
+	parseErr := parsePoems(append(poems, imported...), corpus.Store)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return openPoemStore(corpus.Store)
+}
+
+// setupWindowStore opens the corpus's poem store with its poems cut into windows of the given size, building it from
+// the corpus's poem store first if needed.
+func setupWindowStore(corpus Corpus, store *PoemStore, windowSize int) (*PoemStore, error) {
+	storePath := corpus.windowStore(windowSize)
+	windowStore, storeErr := openPoemStore(storePath)
+	if storeErr == nil {
+		return windowStore, nil
+	}
+	if !os.IsNotExist(storeErr) {
+		log.Printf("Rebuilding poem store: %s\n", storeErr)
+	}
+	log.Printf("Cutting the poems of corpus %s into windows of %d characters\n", corpus.Name, windowSize)
+	windows := []ParsedPoem{}
+	for poemID := range store.Len() {
+		parsedPoem, poemErr := store.Poem(poemID)
+		if poemErr != nil {
+			return nil, poemErr
+		}
+		windows = append(windows, windowPoem(parsedPoem, windowSize)...)
+	}
+	writeErr := writePoemStore(windows, storePath)
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return openPoemStore(storePath)
+}
+
+// windowPoem cuts a parsed poem longer than the window size into windows of whole lines that are at most that long,
+// each one starting about halfway through the one before it. Lines longer than the window size are cut at word breaks
+// first, so that every window fits. Poems that fit in a single window are kept whole.
+func windowPoem(parsedPoem ParsedPoem, windowSize int) []ParsedPoem {
+	if parsedPoem.Length <= windowSize {
+		return []ParsedPoem{parsedPoem}
+	}
+	// Find the units that windows are made of: whole lines, or the pieces of lines that are too long
+	starts, ends := []int{}, []int{}
+	lineStart := 0
+	for _, line := range strings.Split(parsedPoem.Text, "\\n") {
+		if len(line) <= windowSize {
+			starts, ends = append(starts, lineStart), append(ends, lineStart+len(line))
+		} else {
+			cursor := 0
+			for _, piece := range windowPassages(line, windowSize) {
+				pieceStart := cursor + strings.Index(line[cursor:], piece)
+				cursor = pieceStart + len(piece)
+				starts, ends = append(starts, lineStart+pieceStart), append(ends, lineStart+cursor)
+			}
+		}
+		lineStart += len(line) + len("\\n")
+	}
+	isBlank := func(idx int) bool {
+		return strings.TrimSpace(parsedPoem.Text[starts[idx]:ends[idx]]) == ""
+	}
+	windows := []ParsedPoem{}
+	for first := 0; first < len(starts); {
+		// Start windows on a line with text
+		if isBlank(first) {
+			first++
+			continue
+		}
+		last := first
+		for last+1 < len(starts) && ends[last+1]-starts[first] <= windowSize {
+			last++
+		}
+		end := last
+		for end > first && isBlank(end) {
+			end--
+		}
+		window := NewParsedPoem(Poem{parsedPoem.Title, parsedPoem.Author, parsedPoem.Text[starts[first]:ends[end]]})
+		window.Offset = utf8.RuneCountInString(strings.ReplaceAll(parsedPoem.Text[:starts[first]], "\\n", "\n"))
+		window.IsWindow = true
+		windows = append(windows, window)
+		if last == len(starts)-1 {
+			break
+		}
+		// Start the next window halfway through this one, so that the windows overlap
+		next := first + 1
+		for next < last && starts[next]-starts[first] < (ends[last]-starts[first])/2 {
+			next++
+		}
+		first = next
+	}
+	return windows
+}
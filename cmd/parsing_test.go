@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -20,8 +21,51 @@ func TestReadPoemDB(t *testing.T) {
 	if readErr != nil {
 		t.Fail()
 	}
-	parseErr := parsePoems(poems, "testdata/poems_folder")
+	parseErr := parsePoems(poems, "testdata/poems.store")
 	if parseErr != nil {
 		t.Fail()
 	}
 }
+
+func TestWindowPoem(t *testing.T) {
+	short := NewParsedPoem(Poem{"Short", "Ipsum", "lorem ipsum"})
+	if windows := windowPoem(short, 20); len(windows) != 1 || !samePoem(windows[0], short) {
+		t.Fatalf("Poems that fit in a window should be kept whole: %+v", windows)
+	}
+	long := NewParsedPoem(Poem{"Long", "Ipsum", `lorem ipsum\nDolor sit\n\namet, café\nconsectetur\nadipiscing elit`})
+	windows := windowPoem(long, 24)
+	expected := []struct {
+		text   string
+		offset int
+	}{
+		{`lorem ipsum\nDolor sit`, 0},
+		{`Dolor sit\n\namet, café`, 12},
+		{`amet, café\nconsectetur`, 23},
+		{`consectetur`, 34},
+		{`adipiscing elit`, 46},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("Unexpected windows: %+v", windows)
+	}
+	for idx, window := range windows {
+		if window.Text != expected[idx].text || window.Offset != expected[idx].offset || !window.IsWindow {
+			t.Fatalf("Unexpected window %d: %+v", idx, window)
+		}
+		if window.Title != long.Title || window.Author != long.Author || window.Length > 24 {
+			t.Fatalf("Window %d doesn't fit or lost its attribution: %+v", idx, window)
+		}
+	}
+	// Lines longer than the window are cut at word breaks, or inside words longer than the window
+	windows = windowPoem(long, 10)
+	texts := []string{}
+	for _, window := range windows {
+		if window.Length > 10 {
+			t.Fatalf("Window doesn't fit: %+v", window)
+		}
+		texts = append(texts, window.Text)
+	}
+	expectedTexts := []string{"lorem", "ipsum", "Dolor sit", "amet,", "café", "consectetu", "r", "adipiscing", "elit"}
+	if !slices.Equal(texts, expectedTexts) || windows[4].Offset != 29 {
+		t.Fatalf("Unexpected windows of long lines: %+v", windows)
+	}
+}
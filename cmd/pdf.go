@@ -0,0 +1,157 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	pdfPageWidth  = 595.0 // The width of an A4 page [pt].
+	pdfPageHeight = 842.0 // The height of an A4 page [pt].
+	pdfMargin     = 72.0  // The margin around the page [pt].
+	pdfFontSize   = 12.0  // The largest font size [pt]; longer poems are set smaller to fit on the page.
+)
+
+// WritePDF writes the blackout poems as a PDF document for print, one A4 page per poem. Each page is laid out like the
+// terminal output: the poem in Courier with black bars over the erased text, then the message and the attribution.
+// Characters that Courier can't show are replaced with question marks.
+func WritePDF(w io.Writer, blackouts []Blackout) error {
+	var doc bytes.Buffer
+	offsets := []int{}
+	addObject := func(object string) {
+		offsets = append(offsets, doc.Len())
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", len(offsets), object)
+	}
+	doc.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// Objects 1 to 5 are the catalog, the document info, the page tree & the fonts; each page and its contents follow
+	pages := []string{}
+	for idx := range blackouts {
+		pages = append(pages, fmt.Sprintf("%d 0 R", 6+2*idx))
+	}
+	addObject("<< /Type /Catalog /Pages 3 0 R >>")
+	title, author := "", ""
+	if len(blackouts) > 0 {
+		title, author = blackouts[0].Poem.Title, blackouts[0].Poem.Author
+	}
+	addObject(fmt.Sprintf("<< /Title %s /Author %s /Producer (blackout) >>", pdfString(string(winAnsi(title))), pdfString(string(winAnsi(author)))))
+	addObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pages, " "), len(pages)))
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Oblique /Encoding /WinAnsiEncoding >>")
+	for _, b := range blackouts {
+		addObject(fmt.Sprintf("<< /Type /Page /Parent 3 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, len(offsets)+2))
+		content := pdfPageContent(b)
+		addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	// Finish with the cross-reference table of the objects' offsets
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R /Info 2 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(doc.Bytes())
+	return err
+}
+
+// pdfPageContent returns the content stream that draws the blackout poem on a page.
+func pdfPageContent(b Blackout) string {
+	lines := b.Lines()
+	// Courier's characters are 0.6 em wide
+	columns := max(len(winAnsi(b.Message)), len(winAnsi(b.Attribution())), 1)
+	for _, line := range lines {
+		width := 0
+		for _, run := range line {
+			width += len(winAnsi(run.Text))
+		}
+		columns = max(columns, width)
+	}
+	rows := len(lines) + 3
+	fontSize := min(pdfFontSize, (pdfPageWidth-2*pdfMargin)/(0.6*float64(columns)),
+		(pdfPageHeight-2*pdfMargin)/(1.5*float64(rows)))
+	charWidth, lineHeight := 0.6*fontSize, 1.5*fontSize
+	var content strings.Builder
+	baseline := pdfPageHeight - pdfMargin - fontSize
+	writeText := func(font string, x float64, text []byte) {
+		fmt.Fprintf(&content, "BT /%s %.2f Tf %.2f %.2f Td %s Tj ET\n", font, fontSize, x, baseline, pdfString(string(text)))
+	}
+	for _, line := range lines {
+		column := 0
+		for _, run := range line {
+			text := winAnsi(run.Text)
+			x := pdfMargin + float64(column)*charWidth
+			switch {
+			case run.Kept:
+				writeText("F1", x, text)
+			case run.Erased:
+				// Cover the characters from below their descenders to above their capitals
+				fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n",
+					x, baseline-0.25*fontSize, float64(len(text))*charWidth, fontSize)
+			}
+			column += len(text)
+		}
+		baseline -= lineHeight
+	}
+	baseline -= lineHeight
+	writeText("F1", pdfMargin, winAnsi(b.Message))
+	baseline -= lineHeight
+	writeText("F2", pdfMargin, winAnsi(b.Attribution()))
+	return content.String()
+}
+
+// winAnsi encodes the text in the Windows-1252 encoding of PDF's standard fonts, replacing the characters that it
+// can't encode with question marks.
+func winAnsi(text string) []byte {
+	encoded := []byte{}
+	encoder := charmap.Windows1252
+	for _, r := range norm.NFC.String(text) {
+		if b, ok := encoder.EncodeRune(r); ok {
+			encoded = append(encoded, b)
+		} else {
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// pdfString writes the bytes of the text as a PDF literal string.
+func pdfString(text string) string {
+	var literal strings.Builder
+	literal.WriteByte('(')
+	for _, b := range []byte(text) {
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			literal.WriteByte('\\')
+			literal.WriteByte(b)
+		case b < 0x20 || b > 0x7e:
+			fmt.Fprintf(&literal, "\\%03o", b)
+		default:
+			literal.WriteByte(b)
+		}
+	}
+	literal.WriteByte(')')
+	return literal.String()
+}
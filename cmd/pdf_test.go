@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePDF(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem (Café)", "Ipsum", "Dolor Sit\\nAmet 東"})
+	b, err := newBlackout(0, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, []Blackout{b, b}); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatal("The PDF should have a header and a trailer")
+	}
+	// Every cross-reference entry has to point at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	if startxref == nil {
+		t.Fatal("The PDF should have a cross-reference table")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("Unexpected number of objects: %d", len(entries))
+	}
+	for idx, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if !strings.HasPrefix(doc[offset:], fmt.Sprintf("%d 0 obj\n", idx+1)) {
+			t.Fatalf("Cross-reference entry %d points at the wrong offset", idx+1)
+		}
+	}
+	// Every stream's length has to match its contents
+	for _, stream := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)\nendstream`).FindAllStringSubmatch(doc, -1) {
+		if length, _ := strconv.Atoi(stream[1]); length != len(stream[2]) {
+			t.Fatalf("Stream length %d doesn't match its contents (%d)", length, len(stream[2]))
+		}
+	}
+	if !strings.Contains(doc, "/Count 2") || strings.Count(doc, " re f\n") != 2*5 {
+		t.Fatal("The PDF should have a page with bars for each poem")
+	}
+	for _, text := range []string{"(it) Tj", "(me) Tj", "(it me) Tj", `(Excerpt of "Lorem \(Caf\351\)" by Ipsum) Tj`} {
+		if strings.Count(doc, text) != 2 {
+			t.Fatalf("The PDF should show %s on each page", text)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// PNGOptions are the options for rasterizing blackout poems into PNG images.
+type PNGOptions struct {
+	FontSize   float64    // The font size [px]. It is ignored if the image's width is given.
+	Width      int        // The image's width [px], or 0 to fit the image to the poem.
+	Margin     int        // The margin around the poem [px].
+	Text       color.RGBA // The color of the kept text and the attribution.
+	Bars       color.RGBA // The color of the bars over erased text.
+	Background color.RGBA // The color of the image's background.
+}
+
+// WritePNG rasterizes the blackout poems one after another into a single PNG image, with bars over the erased text and
+// each poem's attribution below it, using the bundled Go Mono font.
+func WritePNG(w io.Writer, blackouts []Blackout, opts PNGOptions) error {
+	regular, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return err
+	}
+	italic, err := opentype.Parse(gomonoitalic.TTF)
+	if err != nil {
+		return err
+	}
+	// Lay out the poems' lines, measuring the text with the font itself so that the bars line up with the glyphs
+	attributions := make([]string, len(blackouts))
+	poemLines := make([][][]blackoutRun, len(blackouts))
+	rows := 0
+	for idx, b := range blackouts {
+		poemLines[idx] = b.Lines()
+		attributions[idx] = b.Attribution()
+		rows += len(poemLines[idx]) + 2
+	}
+	rows += max(len(blackouts)-1, 0)
+	fontSize := opts.FontSize
+	if opts.Width > 0 {
+		// Text widths scale with the font size without hinting, so measure it at a reference size and scale to fit
+		const referenceSize = 100.0
+		regularFace, italicFace, err := newPNGFaces(regular, italic, referenceSize)
+		if err != nil {
+			return err
+		}
+		widest := widestLine(regularFace, italicFace, poemLines, attributions)
+		regularFace.Close()
+		italicFace.Close()
+		fontSize = float64(opts.Width-2*opts.Margin) / max(widest, 1) * referenceSize
+	}
+	if fontSize <= 0 {
+		return fmt.Errorf("The image is too small for the poem (font size %.1f px)", fontSize)
+	}
+	regularFace, italicFace, err := newPNGFaces(regular, italic, fontSize)
+	if err != nil {
+		return err
+	}
+	defer regularFace.Close()
+	defer italicFace.Close()
+	metrics := regularFace.Metrics()
+	lineHeight := math.Ceil(1.5 * fontSize)
+	width := opts.Width
+	if width <= 0 {
+		width = 2*opts.Margin + int(math.Ceil(widestLine(regularFace, italicFace, poemLines, attributions)))
+	}
+	height := 2*opts.Margin + int(math.Ceil(float64(rows)*lineHeight))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	// Draw every poem's lines, then its attribution
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(opts.Text), Face: regularFace}
+	bars := image.NewUniform(opts.Bars)
+	ascent, descent := fixedToFloat(metrics.Ascent), fixedToFloat(metrics.Descent)
+	baseline := float64(opts.Margin) + (lineHeight+ascent-descent)/2
+	for idx := range blackouts {
+		if idx > 0 {
+			baseline += lineHeight
+		}
+		for _, line := range poemLines[idx] {
+			x := float64(opts.Margin)
+			for _, run := range line {
+				runWidth := fixedToFloat(font.MeasureString(regularFace, run.Text))
+				switch {
+				case run.Kept:
+					drawer.Dot = fixed.Point26_6{X: floatToFixed(x), Y: floatToFixed(baseline)}
+					drawer.DrawString(run.Text)
+				case run.Erased:
+					bar := image.Rect(int(math.Round(x)), int(math.Round(baseline-ascent)),
+						int(math.Round(x+runWidth)), int(math.Round(baseline+descent)))
+					draw.Draw(img, bar, bars, image.Point{}, draw.Over)
+				}
+				x += runWidth
+			}
+			baseline += lineHeight
+		}
+		baseline += lineHeight
+		drawer.Face = italicFace
+		drawer.Dot = fixed.Point26_6{X: floatToFixed(float64(opts.Margin)), Y: floatToFixed(baseline)}
+		drawer.DrawString(attributions[idx])
+		drawer.Face = regularFace
+		baseline += lineHeight
+	}
+	return png.Encode(w, img)
+}
+
+// newPNGFaces makes the regular and italic faces of the fonts at the given size [px].
+func newPNGFaces(regular *opentype.Font, italic *opentype.Font, size float64) (font.Face, font.Face, error) {
+	faceOpts := &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone}
+	regularFace, err := opentype.NewFace(regular, faceOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	italicFace, err := opentype.NewFace(italic, faceOpts)
+	if err != nil {
+		regularFace.Close()
+		return nil, nil, err
+	}
+	return regularFace, italicFace, nil
+}
+
+// widestLine returns the width of the poems' widest line or attribution, set in the given faces [px]. Lines are
+// measured run by run, in the same way that they are drawn.
+func widestLine(regularFace font.Face, italicFace font.Face, poemLines [][][]blackoutRun, attributions []string) float64 {
+	widest := 0.0
+	for idx, lines := range poemLines {
+		for _, line := range lines {
+			width := 0.0
+			for _, run := range line {
+				width += fixedToFloat(font.MeasureString(regularFace, run.Text))
+			}
+			widest = max(widest, width)
+		}
+		widest = max(widest, fixedToFloat(font.MeasureString(italicFace, attributions[idx])))
+	}
+	return widest
+}
+
+// parseHexColor parses a color written as "#rrggbb" or "#rgb".
+func parseHexColor(hex string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(hex, "#")
+	if len(digits) == 3 {
+		digits = strings.Repeat(digits[0:1], 2) + strings.Repeat(digits[1:2], 2) + strings.Repeat(digits[2:3], 2)
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if len(digits) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("Invalid color %q; expected \"#rrggbb\"", hex)
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 0xff}, nil
+}
+
+// fixedToFloat converts a fixed-point number of pixels to a floating-point one.
+func fixedToFloat(x fixed.Int26_6) float64 {
+	return float64(x) / 64
+}
+
+// floatToFixed converts a floating-point number of pixels to a fixed-point one.
+func floatToFixed(x float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(x * 64))
+}
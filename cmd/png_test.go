@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestWritePNG(t *testing.T) {
+	poem := NewParsedPoem(Poem{"Lorem", "Ipsum", "Dolor Sit\\nAmet"})
+	b, err := newBlackout(0, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, white := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}
+	opts := PNGOptions{20, 0, 10, color.RGBA{0, 0, 0, 0xff}, red, white}
+	for _, width := range []int{0, 500} {
+		opts.Width = width
+		var buf bytes.Buffer
+		if err := WritePNG(&buf, []Blackout{b}, opts); err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width > 0 && img.Bounds().Dx() != width {
+			t.Fatalf("Unexpected image width: %d", img.Bounds().Dx())
+		}
+		if color.RGBAModel.Convert(img.At(0, 0)) != white {
+			t.Fatal("The margin should have the background color")
+		}
+		// The first erased run, "Dolor", starts at the top left of the poem
+		x, y := opts.Margin+2, opts.Margin+img.Bounds().Dy()/10
+		if color.RGBAModel.Convert(img.At(x, y)) != red {
+			t.Fatalf("The erased text should have the bar color, not %v", img.At(x, y))
+		}
+	}
+	// Bars are as wide as the font draws the erased text, even for characters that take two terminal cells
+	wide, err := newBlackout(0, NewParsedPoem(Poem{"Lorem", "Ipsum", "漢 a"}), "a", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Width = 0
+	var buf bytes.Buffer
+	if err := WritePNG(&buf, []Blackout{wide}, opts); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Go Mono draws "漢" as a single 0.6 em column, not two
+	for y := opts.Margin; y < opts.Margin+30; y++ {
+		if x := opts.Margin + 18; color.RGBAModel.Convert(img.At(x, y)) == red {
+			t.Fatalf("The bar should end where the font's glyphs do, not at (%d, %d)", x, y)
+		}
+	}
+	opts.Width = 2 * opts.Margin
+	if err := WritePNG(&bytes.Buffer{}, []Blackout{b}, opts); err == nil {
+		t.Fatal("Images too small for the poem should return an error")
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		hex   string
+		color color.RGBA
+		ok    bool
+	}{
+		{"#000000", color.RGBA{0, 0, 0, 0xff}, true},
+		{"#fed", color.RGBA{0xff, 0xee, 0xdd, 0xff}, true},
+		{"12ab9F", color.RGBA{0x12, 0xab, 0x9f, 0xff}, true},
+		{"red", color.RGBA{}, false},
+		{"#1234567", color.RGBA{}, false},
+	}
+	for _, test := range tests {
+		c, err := parseHexColor(test.hex)
+		if (err == nil) != test.ok || c != test.color {
+			t.Fatalf("Unexpected color for %q: %v, %v", test.hex, c, err)
+		}
+	}
+}
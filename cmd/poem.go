@@ -18,11 +18,9 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
 	"regexp"
 	"strings"
 	"unicode"
@@ -30,8 +28,17 @@ import (
 	"github.com/TwiN/go-away"
 )
 
-// regexEscapes contains the characters that need to be escaped in regexes.
-const regexEscapes = `.+*?()|[]{}^$`
+const (
+	ModeLetters = "letters" // Blackout mode that keeps individual letters of the message.
+	ModeWords   = "words"   // Blackout mode that keeps the message's whole words.
+	ModeMixed   = "mixed"   // Blackout mode that keeps whole words where it can, and word fragments or letters elsewhere.
+)
+
+const (
+	PunctuationIgnore   = "ignore"   // Punctuation handling that leaves the message's punctuation out.
+	PunctuationOptional = "optional" // Punctuation handling that keeps the message's punctuation where the poem allows it.
+	PunctuationRequire  = "require"  // Punctuation handling that keeps all of the message's punctuation.
+)
 
 var (
 	// blackoutRP is the regular expression pointer that matches every non-whitespace charater for blacking out.
@@ -49,11 +56,15 @@ type Poem struct {
 
 // A ParsedPoem has its length and level of profanity pre-computed.
 type ParsedPoem struct {
-	Title     string // The title of the poem.
-	Author    string // The author of the poem.
-	Text      string // The poem's text itself. Poem lines are delineated with the digraph "\n".
-	Length    int    // The poem's length [in characters].
-	IsProfane bool   // Whether the poem's text contains profane language.
+	Title      string       // The title of the poem.
+	Author     string       // The author of the poem.
+	Text       string       // The poem's text itself. Poem lines are delineated with the digraph "\n".
+	Length     int          // The poem's length [in characters].
+	IsProfane  bool         // Whether the poem's text contains profane language.
+	RuneCounts map[rune]int // How many times each non-whitespace character appears in the poem's text.
+	Offset     int          // Where the poem's text starts in its source poem's text, if it's a part of it [characters].
+	IsWindow   bool         // Whether the poem is a window of a longer source poem.
+	Excerpt    *Excerpt     // The stanzas & lines of the source poem that the poem is, if it's an excerpt of it.
 }
 
 // isProfane signals whether a poem's text contains profane language.
@@ -66,42 +77,29 @@ func isProfane(poem Poem) bool {
 func NewParsedPoem(poem Poem) ParsedPoem {
 	length := len(poem.Text)
 	isProfane := isProfane(poem)
-	return ParsedPoem{poem.Title, poem.Author, poem.Text, length, isProfane}
+	runeCounts := countRunes(strings.Replace(poem.Text, "\\n", "\n", -1))
+	return ParsedPoem{poem.Title, poem.Author, poem.Text, length, isProfane, runeCounts, 0, false, nil}
 }
 
-// parsedPoem2json writes the ParsedPoem struct to the given JSON file path.
-func parsedPoem2json(parsedPoem ParsedPoem, jsonFile string) error {
-	// Marshal to JSON bytes
-	poemBytes, err := json.Marshal(parsedPoem)
-	if err != nil {
-		log.Fatal(err)
-		return err
-	}
-	// Write file
-	err = os.WriteFile(jsonFile, poemBytes, 0o666)
-	if err != nil {
-		log.Fatal(err)
-		return err
+// countRunes counts how many times each non-whitespace character appears in the text.
+func countRunes(text string) map[rune]int {
+	runeCounts := map[rune]int{}
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			runeCounts[r]++
+		}
 	}
-	return nil
+	return runeCounts
 }
 
-// json2parsedPoem extracts the ParsedPoem object from the given JSON file path.
-func json2parsedPoem(jsonFile string) (ParsedPoem, error) {
-	// Read the file name
-	var parsedPoem ParsedPoem
-	fileBytes, err := os.ReadFile(jsonFile)
-	if err != nil {
-		log.Fatal(err)
-		return parsedPoem, err
-	}
-	// parse JSON and return poem
-	err = json.Unmarshal(fileBytes, &parsedPoem)
-	if err != nil {
-		log.Fatal(err)
-		return parsedPoem, err
+// hasRunes signals whether a text with the first rune counts has at least as many of each character as the second.
+func hasRunes(runeCounts map[rune]int, needed map[rune]int) bool {
+	for r, count := range needed {
+		if runeCounts[r] < count {
+			return false
+		}
 	}
-	return parsedPoem, err
+	return true
 }
 
 // delineate returns the poem's text with escaped line-break characters replaced with actual line breaks.
@@ -109,43 +107,83 @@ func delineate(parsedPoem ParsedPoem) string {
 	return strings.Replace(parsedPoem.Text, "\\n", "\n", -1)
 }
 
-// buildBlackout takes a poem and the blackout regex that matches it, and returns the blacked out poem as a string.
-func buildBlackout(parsedPoem ParsedPoem, rp *regexp.Regexp) (string, error) {
-	delinatedPoem := delineate(parsedPoem)
-	if !rp.MatchString(delinatedPoem) {
-		err := errors.New("Regex does not match blackout poem")
-		return "", err
-	}
-	groups := rp.FindStringSubmatch(delinatedPoem)
-	rebuiltPoem := ""
-	for idx, group := range groups[1:] {
-		if idx%2 == 0 {
-			blackedGroup := blackoutRP.ReplaceAllString(group, "█")
-			rebuiltPoem += blackedGroup
-		} else {
-			rebuiltPoem += group
-		}
+// renderBlackout blacks out every part of the text outside of the given kept spans with full blocks.
+func renderBlackout(text string, spans []Span) string {
+	return eraseText(text, spans, RuneEraser{'█'})
+}
+
+// MatchOptions are the options for matching a blackout message against poems.
+type MatchOptions struct {
+	Mode           string // The blackout mode.
+	IgnoreCase     bool   // Whether letters match regardless of their case.
+	FoldDiacritics bool   // Whether letters match regardless of their accents and other diacritics.
+	Punctuation    string // How to handle the message's punctuation; empty means requiring it.
+	WordBreaks     bool   // Whether the message's words have to be separated by whitespace in the poem.
+	Lines          bool   // Whether each of the message's words (or lines, if it has several) goes on its own poem line.
+}
+
+// folder returns the text folder that normalizes messages and poems for these options.
+func (mo MatchOptions) folder() textFolder {
+	return textFolder{mo.IgnoreCase, mo.FoldDiacritics}
+}
+
+// neededRunes counts how many of each character a poem needs to black out the message with these options.
+func (mo MatchOptions) neededRunes(message string) map[rune]int {
+	if mo.Punctuation == PunctuationIgnore || mo.Punctuation == PunctuationOptional {
+		// Punctuation may be left out, so poems don't need any
+		message = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return -1
+			}
+			return r
+		}, message)
 	}
-	return rebuiltPoem, nil
+	return mo.folder().foldCounts(countRunes(message))
 }
 
-// msg2regex converts a blackout poem's message into a regex string for searching poems.
-func msg2regex(message string) string {
-	regexString := `(?s)\A`
-	for _, msgChar := range strings.Split(message, "") {
-		if unicode.IsSpace(rune(msgChar[0])) {
-			continue
+// newMatcher makes the matcher for the given message with the given options.
+func newMatcher(message string, opts MatchOptions) (Matcher, error) {
+	switch opts.Punctuation {
+	case "", PunctuationIgnore, PunctuationOptional, PunctuationRequire:
+	default:
+		return nil, fmt.Errorf("Unknown punctuation handling %q", opts.Punctuation)
+	}
+	if opts.Lines {
+		// Match each part of the message on its own, and let the line matcher place them on separate lines
+		opts.Lines = false
+		parts := []Matcher{}
+		for _, part := range messageParts(message) {
+			matcher, err := newMatcher(part, opts)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, matcher)
 		}
-		if strings.Contains(regexEscapes, msgChar) {
-			regexString += `(.*?)(\` + msgChar + `)`
-		} else {
-			regexString += `(.*?)(` + msgChar + `)`
+		return lineMatcher{parts}, nil
+	}
+	folder := opts.folder()
+	if !folder.isIdentity() {
+		// Match the folded message against folded poems
+		opts.IgnoreCase, opts.FoldDiacritics = false, false
+		matcher, err := newMatcher(folder.foldString(message), opts)
+		if err != nil {
+			return nil, err
 		}
+		return foldingMatcher{matcher, folder}, nil
+	}
+	switch opts.Mode {
+	case ModeLetters:
+		log.Printf("Message = %s\n", message)
+		return subsequenceMatcher{letterUnits(message, opts.Punctuation, opts.WordBreaks)}, nil
+	case ModeWords:
+		log.Printf("Message = %s\n", message)
+		return wordsMatcher{messageWords(message, opts.Punctuation, opts.WordBreaks), opts.WordBreaks}, nil
+	case ModeMixed:
+		log.Printf("Message = %s\n", message)
+		return mixedMatcher{messageWords(message, opts.Punctuation, opts.WordBreaks), opts.WordBreaks}, nil
+	default:
+		return nil, fmt.Errorf("Unknown blackout mode %q", opts.Mode)
 	}
-	regexString += `(.*?)\z`
-	log.Printf("Message = %s\n", message)
-	log.Printf("Regex = %s\n", regexString)
-	return regexString
 }
 
 // PrintParsedPoem prints the given (un-blacked-out) poem.
@@ -159,24 +197,9 @@ func PrintParsedPoem(parsedPoem ParsedPoem) {
 	}
 }
 
-// PrintBlackoutPoem prints the given blackout poem from the given poem and hidden message.
-func PrintBlackoutPoem(parsedPoem ParsedPoem, message string) error {
-	// convert message to regex
-	regexString := msg2regex(message)
-	rp := regexp.MustCompile(regexString)
-	// build the blackout poem
-	bp, err := buildBlackout(parsedPoem, rp)
-	if err != nil {
-		return err
-	}
-	// print the blackout poem's lines
-	lines := strings.Split(bp, "\n")
-	for _, line := range lines {
-		fmt.Println(line)
-	}
-	// print the message
-	fmt.Println("\n" + message)
-	// print the title & author
-	fmt.Printf("Excerpt of \"%s\" by %s\n\n", parsedPoem.Title, parsedPoem.Author)
-	return nil
+// PrintBlackoutPoem writes the given blackout poem rendered with the eraser, followed by its hidden message and
+// attribution.
+func PrintBlackoutPoem(w io.Writer, b Blackout, eraser Eraser) error {
+	_, err := fmt.Fprintf(w, "%s\n\n%s\n%s\n\n", b.Render(eraser), b.Message, b.Attribution())
+	return err
 }
@@ -1,6 +1,11 @@
 package cmd
 
-import "testing"
+import (
+	"errors"
+	"log"
+	"regexp"
+	"testing"
+)
 
 var (
 	// Example profane poem.
@@ -20,21 +25,6 @@ func TestIsProfane(t *testing.T) {
 	}
 }
 
-func TestParsedPoemRoundTrip(t *testing.T) {
-	testPoemFilename := "testdata/test_poem.json"
-	jsonErr := parsedPoem2json(nonProfaneParsedPoem, testPoemFilename)
-	if jsonErr != nil {
-		t.Fatal(jsonErr)
-	}
-	filePoem, poemErr := json2parsedPoem(testPoemFilename)
-	if poemErr != nil {
-		t.Fatal(poemErr)
-	}
-	if filePoem != nonProfaneParsedPoem {
-		t.Fatal("Original poem and file-read poem do not match")
-	}
-}
-
 func TestMessage2Regex(t *testing.T) {
 	testMessage1 := "blackoutpoem"
 	testMessage2 := "blackout poem"
@@ -47,3 +37,67 @@ func TestMessage2Regex(t *testing.T) {
 		t.Fatalf("Regexes don't match: %s, %s", testRegex2, msg2regex(testMessage2))
 	}
 }
+
+func TestWordsBlackout(t *testing.T) {
+	matcher, err := newMatcher("Sit Amet", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp, err := buildBlackout(nonProfaneParsedPoem, matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp != "█████ Sit Amet" {
+		t.Fatalf("Unexpected blackout poem: %s", bp)
+	}
+	matcher, err = newMatcher("Si Am", MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doable, _ := canBlackout(matcher, nonProfaneParsedPoem); doable {
+		t.Fatal("Partial words should not match in words mode")
+	}
+	_, err = newMatcher("sit amet", MatchOptions{Mode: "sentences"})
+	if err == nil {
+		t.Fatal("Unknown blackout modes should return an error")
+	}
+}
+
+func TestRuneCounts(t *testing.T) {
+	runeCounts := nonProfaneParsedPoem.RuneCounts
+	if runeCounts['o'] != 2 || runeCounts['t'] != 2 || runeCounts[' '] != 0 {
+		t.Fatalf("Unexpected rune counts: %v", runeCounts)
+	}
+	if !hasRunes(runeCounts, countRunes("Dot Sit")) {
+		t.Fatal("Poem should have enough characters for message")
+	}
+	if hasRunes(runeCounts, countRunes("Dotty")) {
+		t.Fatal("Poem should not have enough characters for message")
+	}
+}
+
+// buildBlackout takes a poem and the matcher for its message, and returns the blacked out poem as a string.
+func buildBlackout(parsedPoem ParsedPoem, matcher Matcher) (string, error) {
+	delinatedPoem := delineate(parsedPoem)
+	spans, ok := matcher.Match(delinatedPoem)
+	if !ok {
+		err := errors.New("Message does not match blackout poem")
+		return "", err
+	}
+	return renderBlackout(delinatedPoem, spans), nil
+}
+
+// msg2regex converts a blackout poem's message into a regex string for searching poems.
+func msg2regex(message string) string {
+	regexString := `(?s)\A`
+	for _, msgChar := range graphemes(message) {
+		if isSpace(msgChar) {
+			continue
+		}
+		regexString += `(.*?)(` + regexp.QuoteMeta(msgChar) + `)`
+	}
+	regexString += `(.*?)\z`
+	log.Printf("Message = %s\n", message)
+	log.Printf("Regex = %s\n", regexString)
+	return regexString
+}
@@ -19,12 +19,13 @@ package cmd
 
 import (
 	"fmt"
+	"image/color"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -37,15 +38,64 @@ public-domain poetry to find one with characters that match a given message,
 then prints the resulting blacked-out poem to standard output.`
 
 const examples = `blackout --help
-blackout 'lorem ipsum' --max-length 800`
+blackout 'lorem ipsum' --max-length 800
+blackout 'lorem ipsum' --mode words
+blackout 'lorem ipsum' --top 5 --pick 2
+blackout 'lorem ipsum' --random --seed 42
+blackout 'a much longer message than usual' --spread 3
+blackout 'a much longer message than usual' --split
+blackout 'Café Noir' --ignore-case --fold-diacritics
+blackout "don't stop." --punctuation optional --word-breaks
+blackout 'black out the night' --lines
+blackout 'lorem ipsum' --format svg > poem.svg
+blackout 'lorem ipsum' --format html > poem.html
+blackout 'lorem ipsum' --format png --width 1080 --bar-color '#222' > poem.png
+blackout 'lorem ipsum' --format pdf > poem.pdf
+blackout 'lorem ipsum' --format json | jq .Kept
+blackout 'lorem ipsum' --format ansi --ansi-style background
+blackout 'lorem ipsum' --erase strike
+blackout corpus import ~/poems --author 'Me'
+blackout corpus import ~/notes --corpus team-notes
+blackout 'lorem ipsum' --corpus public-domain,team-notes
+blackout corpus gutenberg pg1342.txt --corpus austen
+blackout 'lorem ipsum' --corpus austen --windows
+blackout 'lorem ipsum' --excerpts`
+
+// defaultMaxLength is the default maximum poem length, which is also the default size of imported book passages
+// [characters].
+const defaultMaxLength = 400
 
 var (
-	Verbose       bool // Whether to print verbose results.
-	MaxLength     int  // Maximum poem length to black out.
-	PrintOriginal bool // Whether to print the original poem before blacking it out.
-	Profanities   bool // Whether to filter out poems with offensive words while searching.
-	Force         bool // Whether to re-download and re-parse the poems dataset.
-	NThreads      int  // Number of threads.
+	Verbose        bool     // Whether to print verbose results.
+	MaxLength      int      // Maximum poem length to black out.
+	PrintOriginal  bool     // Whether to print the original poem before blacking it out.
+	Profanities    bool     // Whether to filter out poems with offensive words while searching.
+	Force          bool     // Whether to re-download and re-parse the poems dataset.
+	NThreads       int      // Number of threads.
+	Mode           string   // Blackout mode, keeping letters, whole words, or a mix of both from the message.
+	Top            int      // Number of best-scoring poems to list.
+	Pick           int      // Rank of the best-scoring poem to black out.
+	Random         bool     // Whether to black out a random poem instead of the first one found.
+	Seed           int64    // Seed for picking a random poem.
+	Spread         int      // Maximum number of consecutive poems to spread the message across.
+	Split          bool     // Whether to split the message at word boundaries across several poems.
+	IgnoreCase     bool     // Whether to match the message regardless of case.
+	FoldDiacritics bool     // Whether to match the message regardless of diacritics.
+	Punctuation    string   // How to handle the message's punctuation.
+	WordBreaks     bool     // Whether the message's words have to be separated by whitespace in the poem.
+	Lines          bool     // Whether to put each of the message's words (or lines) on its own poem line.
+	Format         string   // Output format of the blackout poem.
+	FontSize       float64  // Font size of PNG images.
+	ImageWidth     int      // Width of PNG images.
+	ImageMargin    int      // Margin around the poem in PNG images.
+	TextColor      string   // Color of the text in PNG images.
+	BarColor       string   // Color of the bars over erased text in PNG images.
+	Background     string   // Background color of PNG images.
+	ANSIStyle      string   // ANSI style of erased text on color terminals.
+	Erase          string   // Erasure style of text output.
+	Corpora        []string // Names of the corpora to search.
+	Windows        bool     // Whether to search windows of longer poems that fit within the maximum length.
+	Excerpts       bool     // Whether to search excerpts of whole stanzas of longer poems that fit within the maximum length.
 )
 
 // rootCmd represents the base command when called without any sub-commands.
@@ -71,11 +121,35 @@ func Execute() {
 // init sets up the flags of the CLI application.
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "V", false, "verbose output")
-	rootCmd.PersistentFlags().IntVarP(&MaxLength, "max-length", "l", 400, "maximum poem length")
+	rootCmd.PersistentFlags().IntVarP(&MaxLength, "max-length", "l", defaultMaxLength, "maximum poem length")
 	rootCmd.PersistentFlags().BoolVarP(&PrintOriginal, "print-original", "o", false, "print original poem before blacking out")
 	rootCmd.PersistentFlags().BoolVarP(&Profanities, "allow-profanities", "p", false, "allow blacking out poems with profanities")
 	rootCmd.PersistentFlags().BoolVarP(&Force, "force", "f", false, "force re-downloading the public domain poetry dataset")
 	rootCmd.PersistentFlags().IntVarP(&NThreads, "threads", "t", runtime.NumCPU(), "how many threads to use for poem searching")
+	rootCmd.PersistentFlags().StringVarP(&Mode, "mode", "m", ModeLetters, "blackout mode (\"letters\", \"words\", or \"mixed\")")
+	rootCmd.PersistentFlags().IntVarP(&Top, "top", "n", 0, "list the given number of best-scoring poems")
+	rootCmd.PersistentFlags().IntVarP(&Pick, "pick", "k", 0, "black out the best-scoring poem with the given rank")
+	rootCmd.PersistentFlags().BoolVarP(&Random, "random", "r", false, "black out a random poem out of all the ones that fit")
+	rootCmd.PersistentFlags().Int64VarP(&Seed, "seed", "s", 0, "seed for picking a random poem (default random)")
+	rootCmd.PersistentFlags().IntVarP(&Spread, "spread", "S", 1, "spread the message across up to this many consecutive poems if no single poem fits")
+	rootCmd.PersistentFlags().BoolVarP(&Split, "split", "x", false, "split the message at word boundaries across several poems if no single poem fits")
+	rootCmd.PersistentFlags().BoolVarP(&IgnoreCase, "ignore-case", "i", false, "match the message regardless of upper or lower case")
+	rootCmd.PersistentFlags().BoolVarP(&FoldDiacritics, "fold-diacritics", "d", false, "match the message regardless of accents and other diacritics")
+	rootCmd.PersistentFlags().StringVarP(&Punctuation, "punctuation", "P", PunctuationRequire, "punctuation handling (\"ignore\", \"optional\", or \"require\")")
+	rootCmd.PersistentFlags().BoolVarP(&WordBreaks, "word-breaks", "w", false, "require whitespace in the poem between the message's words")
+	rootCmd.PersistentFlags().BoolVarP(&Lines, "lines", "L", false, "keep each word of the message (or each line, if it has several) on its own poem line")
+	rootCmd.PersistentFlags().StringVarP(&Format, "format", "F", FormatText, "output format (\"text\", \"ansi\", \"svg\", \"html\", \"png\", \"pdf\", or \"json\")")
+	rootCmd.PersistentFlags().StringVarP(&Erase, "erase", "e", EraseBlock, "erasure style of text and JSON output (\"block\", \"strike\", \"space\", \"underscore\", \"bars\", or any single character)")
+	rootCmd.PersistentFlags().StringVar(&ANSIStyle, "ansi-style", ANSIDim, "style of erased text on color terminals (\"dim\" or \"background\")")
+	rootCmd.PersistentFlags().Float64Var(&FontSize, "font-size", 24, "font size of PNG images [px]")
+	rootCmd.PersistentFlags().IntVar(&ImageWidth, "width", 0, "width of PNG images [px], scaling the font to fit (default fit to the poem)")
+	rootCmd.PersistentFlags().IntVar(&ImageMargin, "margin", 48, "margin around the poem in PNG images [px]")
+	rootCmd.PersistentFlags().StringVar(&TextColor, "text-color", "#000000", "color of the text in PNG images")
+	rootCmd.PersistentFlags().StringVar(&BarColor, "bar-color", "#000000", "color of the bars over erased text in PNG images")
+	rootCmd.PersistentFlags().StringVar(&Background, "background", "#ffffff", "background color of PNG images")
+	rootCmd.PersistentFlags().BoolVarP(&Windows, "windows", "W", false, "search overlapping windows of --max-length characters of longer poems")
+	rootCmd.PersistentFlags().BoolVarP(&Excerpts, "excerpts", "X", false, "search excerpts of whole stanzas of longer poems that fit within --max-length")
+	rootCmd.PersistentFlags().StringSliceVarP(&Corpora, "corpus", "c", []string{publicDomainCorpus}, "names of the corpora to search, in order")
 }
 
 // run runs the CLI application.
@@ -86,44 +160,198 @@ func run(cmd *cobra.Command, args []string) {
 	} else {
 		log.SetOutput(os.Stdout)
 	}
-	// Parse `Force` flag
+	// Parse `Corpora` flag
+	corpora := []Corpus{}
+	for _, name := range Corpora {
+		corpus, corpusErr := newCorpus(name)
+		if corpusErr != nil {
+			fmt.Println(corpusErr)
+			os.Exit(1)
+		}
+		corpora = append(corpora, corpus)
+	}
+	// Parse `Force` flag, keeping the imported poems
 	if Force {
-		os.RemoveAll(dataFolder)
+		os.Remove(legacyFolderJSON)
+		for _, corpus := range corpora {
+			os.Remove(corpus.JSON)
+			stores, _ := filepath.Glob(filepath.Join(corpus.Folder, "*.store"))
+			for _, store := range stores {
+				os.Remove(store)
+			}
+		}
+	}
+	// Parse `Random` flag, which picks a poem without ranking them
+	if Random && (Top > 0 || Pick > 0) {
+		fmt.Println("--random picks a poem without ranking them, so it can't be used with --top or --pick")
+		os.Exit(1)
+	}
+	// Parse `Seed` flag
+	if !cmd.Flags().Changed("seed") {
+		Seed = time.Now().UnixNano()
 	}
 	log.Printf("Running command %s\n", cmd.Name())
-	regexpString := msg2regex(args[0])
-	blackoutRegex := regexp.MustCompile(regexpString)
-	setupErr := setupDataFolder()
-	if setupErr != nil {
-		log.Fatalf(setupErr.Error())
+	opts := MatchOptions{Mode, IgnoreCase, FoldDiacritics, Punctuation, WordBreaks, Lines}
+	matcher, matcherErr := newMatcher(args[0], opts)
+	if matcherErr != nil {
+		fmt.Printf("Could not make a blackout matcher for message `%s`: %s\n", args[0], matcherErr)
+		log.Fatal(matcherErr)
+	}
+	outputOpts, outputErr := newOutputOptions()
+	if outputErr != nil {
+		fmt.Println(outputErr)
+		os.Exit(1)
 	}
-	dir, dirErr := os.ReadDir(dataFolderPoems)
-	if dirErr != nil {
-		log.Fatalf(dirErr.Error())
+	windowSize := 0
+	if Windows {
+		windowSize = MaxLength
 	}
-	sp := SearchParams{dataFolderPoems, len(dir), NThreads, blackoutRegex, MaxLength, Profanities}
+	stores, setupErr := setupDataFolder(Corpora, windowSize)
+	if setupErr != nil {
+		fmt.Println(setupErr)
+		log.Fatal(setupErr)
+	}
+	sp := SearchParams{stores, stores.Len(), NThreads, matcher, opts, opts.neededRunes(args[0]), MaxLength, Profanities, Excerpts}
 	log.Printf("# poems\t: %d", sp.NPoems)
 	log.Printf("# threads\t: %d", sp.NThreads)
 	log.Printf("max length [chars]\t: %d", sp.MaxLength)
 	log.Printf("profanities\t: %t", sp.Profanities)
-	poemID, err := searchPoemsFolder(sp)
+	log.Printf("excerpts\t: %t", sp.Excerpts)
+	if Random {
+		log.Printf("seed\t: %d", Seed)
+	}
+	poemID, err := choosePoem(sp)
+	parts := []MessagePart{{poemID, args[0], nil}}
+	if err != nil && Spread > 1 {
+		log.Printf("No single poem fits; spreading message across up to %d poems\n", Spread)
+		parts, err = searchConsecutivePoems(sp, args[0], Spread)
+	}
+	if err != nil && Split {
+		log.Println("No single poem fits; splitting message across several poems")
+		parts, err = searchSplitPoems(sp, args[0])
+	}
 	if err != nil {
 		fmt.Printf("Could not find a blackout poem for message `%s`\n", args[0])
+		if countNonSpace(args[0]) > MaxLength {
+			fmt.Printf("The message is longer than the maximum poem length (%d); try a larger --max-length, --spread or --split\n", MaxLength)
+		}
 		log.Fatal(err)
 	}
-	poem, err := json2parsedPoem(filepath.Join(dataFolderPoems, poemFilename(poemID)))
+	if parts[0].ID == searchFailure {
+		return
+	}
+	printPoems(stores, parts, opts, outputOpts)
+}
+
+// newOutputOptions checks the output flags, and gathers them into output options.
+func newOutputOptions() (OutputOptions, error) {
+	if !slices.Contains(outputFormats, Format) {
+		return OutputOptions{}, fmt.Errorf("Unknown output format %q; choose one of %q", Format, outputFormats)
+	}
+	if PrintOriginal && Format != FormatText && Format != FormatANSI {
+		return OutputOptions{}, fmt.Errorf("--print-original only works with the \"%s\" and \"%s\" formats", FormatText, FormatANSI)
+	}
+	if Erase != EraseBlock && Format != FormatText && Format != FormatJSON {
+		return OutputOptions{}, fmt.Errorf("--erase only works with the \"%s\" and \"%s\" formats", FormatText, FormatJSON)
+	}
+	// The ranking is printed before the poem, so it would corrupt the other formats' output
+	if Top > 0 && Format != FormatText && Format != FormatANSI {
+		return OutputOptions{}, fmt.Errorf("--top only works with the \"%s\" and \"%s\" formats", FormatText, FormatANSI)
+	}
+	if _, ok := ansiStyles[ANSIStyle]; !ok {
+		return OutputOptions{}, fmt.Errorf("Unknown ANSI style %q; choose \"%s\" or \"%s\"", ANSIStyle, ANSIDim, ANSIBackground)
+	}
+	eraser, err := NewEraser(Erase)
 	if err != nil {
-		log.Fatal(err)
+		return OutputOptions{}, err
 	}
-	if Verbose {
-		time.Sleep(1 * time.Second)
+	format := Format
+	if format == FormatANSI && !colorsEnabled() {
+		log.Println("Standard output is not a color terminal; printing with block characters instead")
+		format = FormatText
 	}
-	if PrintOriginal {
-		PrintParsedPoem(poem)
-		print("\n")
+	colors := []color.RGBA{}
+	for _, hex := range []string{TextColor, BarColor, Background} {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return OutputOptions{}, err
+		}
+		colors = append(colors, c)
 	}
-	printErr := PrintBlackoutPoem(poem, args[0])
-	if printErr != nil {
-		log.Fatal(err)
+	return OutputOptions{format, PNGOptions{FontSize, ImageWidth, ImageMargin, colors[0], colors[1], colors[2]}, ANSIStyle, eraser}, nil
+}
+
+// printPoems prints the poems of the message parts from the poem stores, blacked out with their parts of the message and
+// the given options, with the given output options.
+func printPoems(stores PoemStores, parts []MessagePart, opts MatchOptions, outputOpts OutputOptions) {
+	blackouts := []Blackout{}
+	for _, part := range parts {
+		poem, err := stores.Poem(part.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Black out the same excerpt of a long poem that the search found
+		if part.Excerpt != nil {
+			poem = *part.Excerpt
+		} else if Excerpts && poem.Length > MaxLength {
+			matcher, err := newMatcher(part.Message, opts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if excerpt, ok := bestExcerpt(poem, matcher, MaxLength); ok {
+				poem = excerpt
+			}
+		}
+		if Verbose {
+			time.Sleep(1 * time.Second)
+		}
+		if PrintOriginal {
+			PrintParsedPoem(poem)
+			fmt.Println()
+		}
+		b, err := newBlackout(part.ID, poem, part.Message, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		blackouts = append(blackouts, b)
+	}
+	writeErr := writeBlackouts(os.Stdout, blackouts, outputOpts)
+	if writeErr != nil {
+		log.Fatal(writeErr)
+	}
+}
+
+// choosePoem picks the ID of the poem to black out. By default it is the earliest poem in the index that fits, but when
+// ranking it is the picked poem out of the best-scoring ones, and in random mode it is any one of the poems that fit.
+// If only a ranking was asked for, then it lists the ranking and returns `searchFailure` without an error.
+func choosePoem(sp SearchParams) (int, error) {
+	if Random {
+		return searchRandomPoem(sp, Seed)
+	}
+	// Mixed blackouts are chosen by how readable they are, not by poem ID
+	if Top <= 0 && Pick <= 0 && Mode != ModeMixed {
+		return searchPoemsFolder(sp)
+	}
+	pick := max(Pick, 1)
+	candidates, err := rankPoems(sp, max(Top, pick))
+	if err != nil {
+		return searchFailure, err
+	}
+	if Top > 0 {
+		for idx, c := range candidates[:min(Top, len(candidates))] {
+			poem, err := sp.Stores.Poem(c.ID)
+			if err != nil {
+				return searchFailure, err
+			}
+			PrintCandidate(idx+1, c, poem)
+		}
+		if Pick <= 0 {
+			return searchFailure, nil
+		}
+		fmt.Println()
+	}
+	if pick > len(candidates) {
+		return searchFailure, fmt.Errorf("Only found %d blackout poems to pick from", len(candidates))
 	}
+	return candidates[pick-1].ID, nil
 }
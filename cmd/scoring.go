@@ -0,0 +1,118 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A Score rates how well a poem's blackout reads.
+type Score struct {
+	Visible    float64 // The fraction of the poem's non-whitespace characters kept visible.
+	Spread     float64 // The fraction of the poem's text between the first and last kept characters.
+	Lines      int     // The number of poem lines with kept characters.
+	WholeWords int     // The number of kept spans that are whole words.
+	Total      float64 // The overall score; higher is better.
+}
+
+// A Candidate is a poem that can be blacked out, along with the score of its blackout.
+type Candidate struct {
+	ID    int   // The poem's ID.
+	Score Score // The score of the poem's blackout.
+}
+
+// scoreBlackout scores the blackout of the delineated text that keeps the given spans.
+//
+// The total score is the number of whole words kept, plus the average of the spread, the fraction of lines used,
+// and the fraction of text blacked out. Whole words therefore outweigh every other part of the score.
+func scoreBlackout(text string, spans []Span) Score {
+	score := Score{WholeWords: wholeWords(text, spans)}
+	totalChars, keptChars := countNonSpace(text), 0
+	lines := map[int]bool{}
+	for _, span := range spans {
+		keptChars += countNonSpace(text[span.Start:span.End])
+		lines[strings.Count(text[:span.Start], "\n")] = true
+	}
+	score.Lines = len(lines)
+	if totalChars > 0 {
+		score.Visible = float64(keptChars) / float64(totalChars)
+	}
+	if len(spans) > 0 && len(text) > 0 {
+		score.Spread = float64(spans[len(spans)-1].End-spans[0].Start) / float64(len(text))
+	}
+	lineFraction := float64(score.Lines) / float64(strings.Count(text, "\n")+1)
+	score.Total = float64(score.WholeWords) + (score.Spread+lineFraction+(1-score.Visible))/3
+	return score
+}
+
+// wholeWords counts the kept spans of the text that are whole words.
+func wholeWords(text string, spans []Span) int {
+	hits := 0
+	for _, span := range spans {
+		if isWholeWord(text, span) {
+			hits++
+		}
+	}
+	return hits
+}
+
+// countNonSpace counts the non-whitespace characters in the text.
+func countNonSpace(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// isBetter signals whether the first candidate ranks above the second. Ties go to the smaller poem ID.
+func isBetter(first Candidate, second Candidate) bool {
+	if first.Score.Total != second.Score.Total {
+		return first.Score.Total > second.Score.Total
+	}
+	return first.ID < second.ID
+}
+
+// insertCandidate adds the candidate to the ranked list of candidates, keeping at most `n` of the best.
+func insertCandidate(ranked []Candidate, c Candidate, n int) []Candidate {
+	idx := len(ranked)
+	for idx > 0 && isBetter(c, ranked[idx-1]) {
+		idx--
+	}
+	if idx >= n {
+		return ranked
+	}
+	ranked = append(ranked, Candidate{})
+	copy(ranked[idx+1:], ranked[idx:])
+	ranked[idx] = c
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// PrintCandidate prints the given ranked candidate poem with its score.
+func PrintCandidate(rank int, c Candidate, parsedPoem ParsedPoem) {
+	fmt.Printf("#%d\tpoem %d\tscore %.3f (%.1f%% visible, %.2f spread, %d lines, %d whole words)\t\"%s\" by %s\n",
+		rank, c.ID, c.Score.Total, 100*c.Score.Visible, c.Score.Spread, c.Score.Lines, c.Score.WholeWords,
+		parsedPoem.Title, parsedPoem.Author)
+}
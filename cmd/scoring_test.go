@@ -0,0 +1,37 @@
+package cmd
+
+import "testing"
+
+func TestScoreBlackout(t *testing.T) {
+	text := "ab cd\nef gh"
+	score := scoreBlackout(text, []Span{{0, 2}, {9, 11}})
+	if score.WholeWords != 2 || score.Lines != 2 {
+		t.Fatalf("Unexpected score: %+v", score)
+	}
+	if score.Visible != 0.5 || score.Spread != 1 {
+		t.Fatalf("Unexpected score: %+v", score)
+	}
+	if score.Total != 2+(1+1+0.5)/3 {
+		t.Fatalf("Unexpected total score: %f", score.Total)
+	}
+	fragments := scoreBlackout(text, []Span{{1, 2}, {9, 10}})
+	if fragments.Total >= score.Total {
+		t.Fatalf("Fragments should score lower than whole words: %f >= %f", fragments.Total, score.Total)
+	}
+}
+
+func TestInsertCandidate(t *testing.T) {
+	ranked := []Candidate{}
+	for id, total := range []float64{1, 3, 2, 3, 0.5} {
+		ranked = insertCandidate(ranked, Candidate{id, Score{Total: total}}, 3)
+	}
+	expected := []int{1, 3, 2}
+	if len(ranked) != len(expected) {
+		t.Fatalf("Unexpected ranking: %v", ranked)
+	}
+	for idx, c := range ranked {
+		if c.ID != expected[idx] {
+			t.Fatalf("Unexpected ranking: %v", ranked)
+		}
+	}
+}
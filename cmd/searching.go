@@ -19,9 +19,14 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"log"
-	"path/filepath"
-	"regexp"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // default return value for when a searching function fails; the maximum integer value.
@@ -29,15 +34,25 @@ const searchFailure = int(^uint(0) >> 1)
 
 // A SearchParams struct contains common information about the poem searching function.
 type SearchParams struct {
-	PoemsFolder string         // The file path to the poems folder.
-	NPoems      int            // The number of poems in the poems folder.
-	NThreads    int            // The number of goroutines to dispatch when searching.
-	RP          *regexp.Regexp // The blackout regex pointer.
-	MaxLength   int            // The maximum poem length [characters]
-	Profanities bool           // Whether to allow profanities in searching.
+	Stores      PoemStores   // The poem stores to search.
+	NPoems      int          // The number of poems in the poem stores.
+	NThreads    int          // The number of goroutines to dispatch when searching.
+	Matcher     Matcher      // The blackout message's matcher.
+	Options     MatchOptions // The options that the blackout message's matcher was made with.
+	Needed      map[rune]int // How many of each character a poem needs to fit the message, if checking beforehand.
+	MaxLength   int          // The maximum poem length [characters]
+	Profanities bool         // Whether to allow profanities in searching.
+	Excerpts    bool         // Whether to search excerpts of the poems longer than the maximum length.
 }
 
-// searchPoemsFolder searches the poems folder for poems smaller than the maximum length that match the given blackout regex.
+// A MessagePart is a poem that blacks out one part of a message that is spread across several poems.
+type MessagePart struct {
+	ID      int         // The poem's ID.
+	Message string      // The part of the message blacked out of the poem.
+	Excerpt *ParsedPoem // The excerpt of the poem that blacks out the part, if the poem is too long and it was chosen.
+}
+
+// searchPoemsFolder searches the poem store for poems smaller than the maximum length that match the given blackout message.
 func searchPoemsFolder(sp SearchParams) (int, error) {
 	// Initialize important search parameters
 
@@ -74,7 +89,7 @@ func searchPoemsFolder(sp SearchParams) (int, error) {
 // searchEveryNPoems is a goroutine that searches every `sp.NRoutines` poems for one that:
 //
 // - is shorter than the maximum length
-// - matches the blackout regex
+// - matches the blackout message
 // - matches the search profanity level
 //
 // It starts from the poem at index `startID`. If it finds a poem to black out, then it sends the poem ID through the `found` channel. If it is the first (by time) to find a poem, then it sends that ID through the `foundFirst` channels.
@@ -84,24 +99,12 @@ func searchEveryNPoems(startID int, sp SearchParams, found chan int, foundFirst
 	// Search the poem IDs that this routine is responsible for
 	for poemID := startID; poemID < sp.NPoems; poemID += sp.NThreads {
 		// Read the current poem
-		poemPath := filepath.Join(sp.PoemsFolder, poemFilename(poemID))
-		parsedPoem, readErr := json2parsedPoem(poemPath)
-		if readErr != nil {
-			log.Printf("Goroutine %d\t: got an error trying to read Poem %d\n", startID, poemID)
-			log.Fatal(readErr)
-		}
-		// Check the poem's length
-		if parsedPoem.Length > sp.MaxLength {
-			log.Printf("Goroutine %d\t: Poem %d is too long (%d > %d)", startID, poemID, parsedPoem.Length, sp.MaxLength)
-			continue
-		}
-		// Check if the poem's profanity level fits within search params
-		if parsedPoem.IsProfane && !sp.Profanities {
-			log.Printf("Goroutine %d\t: Poem %d contains profane words", startID, poemID)
+		parsedPoem, searchable := readSearchablePoem(startID, poemID, sp)
+		if !searchable {
 			continue
 		}
 		// Check if it can be blacked out
-		doable, err := canBlackout(sp.RP, parsedPoem)
+		doable, err := canBlackout(sp.Matcher, parsedPoem)
 		if err != nil {
 			log.Printf("Goroutine %d\t: got an error trying to black out Poem %d\n", startID, poemID)
 			log.Fatal(err)
@@ -135,8 +138,315 @@ func searchEveryNPoems(startID int, sp SearchParams, found chan int, foundFirst
 	found <- searchFailure
 }
 
-// canBlackout signals whether the given parsed poem can be blacked out with the regex.
-func canBlackout(rp *regexp.Regexp, parsedPoem ParsedPoem) (bool, error) {
+// rankPoems searches the whole poem store for the `n` poems smaller than the maximum length with the best-scoring
+// blackouts, from best to worst.
+func rankPoems(sp SearchParams, n int) ([]Candidate, error) {
+	// Channel where the goroutines send their best-scoring poems.
+	ranked := make(chan []Candidate, sp.NThreads)
+	for idx := 0; idx < sp.NThreads; idx++ {
+		log.Printf("Starting ranking goroutine #%d\n", idx)
+		go rankEveryNPoems(idx, sp, n, ranked)
+	}
+	best := []Candidate{}
+	for i := 0; i < sp.NThreads; i++ {
+		for _, c := range <-ranked {
+			best = insertCandidate(best, c, n)
+		}
+		log.Printf("Main thread\t: received ranking from goroutine; %d best poems so far\n", len(best))
+	}
+	if len(best) == 0 {
+		searchErr := errors.New("Failed to find a blackout poem")
+		return best, searchErr
+	}
+	return best, nil
+}
+
+// rankEveryNPoems is a goroutine that scores every `sp.NThreads` poems, starting from the poem at index `startID`,
+// and sends the `n` best-scoring ones that can be blacked out through the `ranked` channel.
+func rankEveryNPoems(startID int, sp SearchParams, n int, ranked chan []Candidate) {
+	best := []Candidate{}
+	for poemID := startID; poemID < sp.NPoems; poemID += sp.NThreads {
+		parsedPoem, searchable := readSearchablePoem(startID, poemID, sp)
+		if !searchable {
+			continue
+		}
+		delineatedPoem := delineate(parsedPoem)
+		spans, ok := sp.Matcher.Match(delineatedPoem)
+		if !ok {
+			log.Printf("Goroutine %d\t: can't black out poem %d\n", startID, poemID)
+			continue
+		}
+		score := scoreBlackout(delineatedPoem, spans)
+		log.Printf("Goroutine %d\t: poem %d scores %.3f\n", startID, poemID, score.Total)
+		best = insertCandidate(best, Candidate{poemID, score}, n)
+	}
+	ranked <- best
+}
+
+// searchAllPoems searches the whole poem store for every poem smaller than the maximum length that matches the given
+// blackout message, and returns their IDs in increasing order.
+func searchAllPoems(sp SearchParams) ([]int, error) {
+	// Channel where the goroutines send the poem IDs they found.
+	found := make(chan []int, sp.NThreads)
+	for idx := 0; idx < sp.NThreads; idx++ {
+		log.Printf("Starting collecting goroutine #%d\n", idx)
+		go collectEveryNPoems(idx, sp, found)
+	}
+	poemIDs := []int{}
+	for i := 0; i < sp.NThreads; i++ {
+		poemIDs = append(poemIDs, <-found...)
+	}
+	slices.Sort(poemIDs)
+	log.Printf("Main thread\t: found %d poems to black out\n", len(poemIDs))
+	if len(poemIDs) == 0 {
+		searchErr := errors.New("Failed to find a blackout poem")
+		return poemIDs, searchErr
+	}
+	return poemIDs, nil
+}
+
+// collectEveryNPoems is a goroutine that checks every `sp.NThreads` poems, starting from the poem at index `startID`,
+// and sends the IDs of all the ones that can be blacked out through the `found` channel.
+func collectEveryNPoems(startID int, sp SearchParams, found chan []int) {
+	poemIDs := []int{}
+	for poemID := startID; poemID < sp.NPoems; poemID += sp.NThreads {
+		parsedPoem, searchable := readSearchablePoem(startID, poemID, sp)
+		if !searchable {
+			continue
+		}
+		doable, err := canBlackout(sp.Matcher, parsedPoem)
+		if err != nil {
+			log.Printf("Goroutine %d\t: got an error trying to black out Poem %d\n", startID, poemID)
+			log.Fatal(err)
+		}
+		if doable {
+			poemIDs = append(poemIDs, poemID)
+		}
+	}
+	found <- poemIDs
+}
+
+// searchRandomPoem picks a random poem smaller than the maximum length that matches the given blackout message. The
+// same seed always picks the same poem out of the same poem store.
+func searchRandomPoem(sp SearchParams, seed int64) (int, error) {
+	poemIDs, err := searchAllPoems(sp)
+	if err != nil {
+		return searchFailure, err
+	}
+	rng := rand.New(rand.NewSource(seed))
+	return poemIDs[rng.Intn(len(poemIDs))], nil
+}
+
+// searchConsecutivePoems searches the poem store for the earliest run of at most `n` consecutive poems smaller than
+// the maximum length that can black out the message together, each one blacking out the next part of the message.
+func searchConsecutivePoems(sp SearchParams, message string, n int) ([]MessagePart, error) {
+	// Every poem only needs the characters of its own part of the message
+	sp.Needed = nil
+	if strings.TrimSpace(message) == "" {
+		return []MessagePart{}, errors.New("The message is empty, so there is nothing to spread across poems")
+	}
+	pieces := messagePieces(message, sp.Options.Mode)
+	// Channel where the goroutines send the earliest run of poems they found.
+	found := make(chan []MessagePart, sp.NThreads)
+	for idx := 0; idx < sp.NThreads; idx++ {
+		log.Printf("Starting spreading goroutine #%d\n", idx)
+		go spreadEveryNPoems(idx, sp, pieces, n, found)
+	}
+	earliest := []MessagePart{}
+	for i := 0; i < sp.NThreads; i++ {
+		parts := <-found
+		if len(parts) > 0 && (len(earliest) == 0 || parts[0].ID < earliest[0].ID) {
+			earliest = parts
+		}
+	}
+	if len(earliest) == 0 {
+		searchErr := errors.New("Failed to find consecutive blackout poems")
+		return earliest, searchErr
+	}
+	return earliest, nil
+}
+
+// spreadEveryNPoems is a goroutine that tries to spread the message's pieces across the consecutive poems starting at
+// every `sp.NThreads` poems, starting from the poem at index `startID`. It sends the first run of poems that works
+// through the `found` channel, or an empty run if none of them do.
+func spreadEveryNPoems(startID int, sp SearchParams, pieces []string, n int, found chan []MessagePart) {
+	for firstID := startID; firstID < sp.NPoems; firstID += sp.NThreads {
+		parts := []MessagePart{}
+		rest := pieces
+		for poemID := firstID; poemID < min(firstID+n, sp.NPoems) && len(rest) > 0; poemID++ {
+			// Excerpts of long poems are chosen for their own part of the message, not the whole message
+			parsedPoem, searchable := readFittingPoem(startID, poemID, sp)
+			if !searchable {
+				break
+			}
+			excerpt, nPieces := fittingExcerpt(parsedPoem, rest, sp)
+			if nPieces == 0 {
+				break
+			}
+			parts = append(parts, MessagePart{poemID, strings.TrimSpace(strings.Join(rest[:nPieces], "")), excerpt})
+			rest = rest[nPieces:]
+		}
+		if len(rest) == 0 {
+			log.Printf("Goroutine %d\t: spread message across poems %d to %d\n", startID, firstID, parts[len(parts)-1].ID)
+			found <- parts
+			return
+		}
+	}
+	found <- []MessagePart{}
+}
+
+// searchSplitPoems splits the message at word boundaries across a sequence of poems smaller than the maximum length,
+// greedily giving each poem as many of the message's next words as it can black out.
+func searchSplitPoems(sp SearchParams, message string) ([]MessagePart, error) {
+	parts := []MessagePart{}
+	if strings.TrimSpace(message) == "" {
+		return parts, errors.New("The message is empty, so there is nothing to split across poems")
+	}
+	pieces := messagePieces(message, ModeWords)
+	for len(pieces) > 0 {
+		// Find the most words that a single poem can black out
+		fittingIDs := map[int]int{}
+		nPieces := sort.Search(len(pieces), func(n int) bool {
+			poemID, err := searchMessagePart(sp, strings.Join(pieces[:n+1], ""))
+			if err != nil {
+				return true
+			}
+			fittingIDs[n+1] = poemID
+			return false
+		})
+		if nPieces == 0 {
+			return parts, fmt.Errorf("Failed to find a blackout poem for `%s`", strings.TrimSpace(pieces[0]))
+		}
+		log.Printf("Main thread\t: poem %d fits the next %d words of the message\n", fittingIDs[nPieces], nPieces)
+		parts = append(parts, MessagePart{fittingIDs[nPieces], strings.TrimSpace(strings.Join(pieces[:nPieces], "")), nil})
+		pieces = pieces[nPieces:]
+	}
+	return parts, nil
+}
+
+// searchMessagePart searches the poem store for the earliest poem that can black out the given part of a message.
+func searchMessagePart(sp SearchParams, messagePart string) (int, error) {
+	matcher, err := newMatcher(messagePart, sp.Options)
+	if err != nil {
+		return searchFailure, err
+	}
+	sp.Matcher = matcher
+	sp.Needed = sp.Options.neededRunes(messagePart)
+	return searchPoemsFolder(sp)
+}
+
+// fittingPieces returns the largest number of the message's first pieces that the text can black out together.
+func fittingPieces(text string, pieces []string, opts MatchOptions) int {
+	// If some pieces fit, then fewer pieces fit as well
+	return sort.Search(len(pieces), func(nPieces int) bool {
+		matcher, err := newMatcher(strings.Join(pieces[:nPieces+1], ""), opts)
+		if err != nil {
+			return true
+		}
+		_, ok := matcher.Match(text)
+		return !ok
+	})
+}
+
+// fittingExcerpt returns the largest number of the message's first pieces that the parsed poem can black out together.
+// If the poem is longer than the maximum length, then they have to fit in one of its excerpts, and it also returns the
+// best-scoring excerpt that blacks them out.
+func fittingExcerpt(parsedPoem ParsedPoem, pieces []string, sp SearchParams) (*ParsedPoem, int) {
+	if parsedPoem.Length <= sp.MaxLength {
+		return nil, fittingPieces(delineate(parsedPoem), pieces, sp.Options)
+	}
+	nPieces := 0
+	for _, excerpt := range poemExcerpts(parsedPoem, sp.MaxLength) {
+		nPieces = max(nPieces, fittingPieces(delineate(excerpt), pieces, sp.Options))
+	}
+	if nPieces == 0 {
+		return nil, 0
+	}
+	matcher, err := newMatcher(strings.TrimSpace(strings.Join(pieces[:nPieces], "")), sp.Options)
+	if err != nil {
+		return nil, 0
+	}
+	excerpt, ok := bestExcerpt(parsedPoem, matcher, sp.MaxLength)
+	if !ok {
+		return nil, 0
+	}
+	return &excerpt, nPieces
+}
+
+// messagePieces splits the message into the smallest pieces that it can be spread across poems with: single characters
+// in letters mode, or whole words otherwise. Each piece keeps the whitespace before it.
+func messagePieces(message string, mode string) []string {
+	pieces := []string{}
+	start, wordEnd := 0, 0
+	for idx, r := range message {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		// Cut the message at the end of the previous character or word
+		if wordEnd > start && (mode == ModeLetters || wordEnd < idx) {
+			pieces = append(pieces, message[start:wordEnd])
+			start = wordEnd
+		}
+		wordEnd = idx + utf8.RuneLen(r)
+	}
+	if start < len(message) {
+		pieces = append(pieces, message[start:])
+	}
+	return pieces
+}
+
+// readSearchablePoem reads the poem with the given ID, and signals whether it fits the search's length and profanity
+// parameters. It also rejects poems that don't have enough of some character of the message, which is much cheaper
+// than finding out by matching the whole message. When searching excerpts, poems that are too long are replaced by
+// their best-scoring excerpt that fits.
+func readSearchablePoem(startID int, poemID int, sp SearchParams) (ParsedPoem, bool) {
+	parsedPoem, searchable := readFittingPoem(startID, poemID, sp)
+	if !searchable || parsedPoem.Length <= sp.MaxLength {
+		return parsedPoem, searchable
+	}
+	// Find the best excerpt of a poem that is too long
+	excerpt, ok := bestExcerpt(parsedPoem, sp.Matcher, sp.MaxLength)
+	if !ok {
+		log.Printf("Goroutine %d\t: Poem %d is too long (%d > %d), and no excerpt fits", startID, poemID, parsedPoem.Length, sp.MaxLength)
+		return parsedPoem, false
+	}
+	log.Printf("Goroutine %d\t: Poem %d is too long (%d > %d); using %s", startID, poemID, parsedPoem.Length, sp.MaxLength, excerpt.Excerpt)
+	return excerpt, true
+}
+
+// readFittingPoem reads the poem with the given ID, and signals whether it passes the length, profanity and character
+// checks of readSearchablePoem. When searching excerpts, poems that are too long are kept whole, for their excerpts to
+// be chosen from.
+func readFittingPoem(startID int, poemID int, sp SearchParams) (ParsedPoem, bool) {
+	// The checks only need the poem's counts and flags, so its text is only decoded if they pass
+	parsedPoem, fits, readErr := sp.Stores.PoemIf(poemID, func(parsedPoem ParsedPoem) bool {
+		// Check the poem's length
+		if parsedPoem.Length > sp.MaxLength && !sp.Excerpts {
+			log.Printf("Goroutine %d\t: Poem %d is too long (%d > %d)", startID, poemID, parsedPoem.Length, sp.MaxLength)
+			return false
+		}
+		// Check if the poem's profanity level fits within search params
+		if parsedPoem.IsProfane && !sp.Profanities {
+			log.Printf("Goroutine %d\t: Poem %d contains profane words", startID, poemID)
+			return false
+		}
+		// Check if the poem has enough characters for the message
+		if sp.Needed != nil && !sp.Options.folder().hasRunes(parsedPoem.RuneCounts, sp.Needed) {
+			log.Printf("Goroutine %d\t: Poem %d lacks characters of the message", startID, poemID)
+			return false
+		}
+		return true
+	})
+	if readErr != nil {
+		log.Printf("Goroutine %d\t: got an error trying to read Poem %d\n", startID, poemID)
+		log.Fatal(readErr)
+	}
+	return parsedPoem, fits
+}
+
+// canBlackout signals whether the given parsed poem can be blacked out with the matcher.
+func canBlackout(matcher Matcher, parsedPoem ParsedPoem) (bool, error) {
 	delineatedPoem := delineate(parsedPoem)
-	return rp.MatchString(delineatedPoem), nil
+	_, ok := matcher.Match(delineatedPoem)
+	return ok, nil
 }
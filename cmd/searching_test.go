@@ -1,8 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -10,18 +18,32 @@ const (
 	MaxInt = int(^uint(0) >> 1)
 )
 
+// newTestStore writes the poems to a temporary poem store, and opens it.
+func newTestStore(t testing.TB, poems []Poem) *PoemStore {
+	storePath := filepath.Join(t.TempDir(), "poems.store")
+	parseErr := parsePoems(poems, storePath)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	store, storeErr := openPoemStore(storePath)
+	if storeErr != nil {
+		t.Fatal(storeErr)
+	}
+	return store
+}
+
 func TestCanBlackout(t *testing.T) {
 	goodRegexP, _ := regexp.Compile("e")
 	badRegexP, _ := regexp.Compile("xxxxxx")
 
-	goodR, err := canBlackout(goodRegexP, nonProfaneParsedPoem)
+	goodR, err := canBlackout(regexMatcher{goodRegexP}, nonProfaneParsedPoem)
 	if !(err == nil && goodR == true) {
 		t.Logf("Error: %s", err.Error())
 		t.Logf("Good regex with good length: %t", goodR)
 		t.Fail()
 	}
 	// Check bad regex with good length -> false
-	badR, err := canBlackout(badRegexP, nonProfaneParsedPoem)
+	badR, err := canBlackout(regexMatcher{badRegexP}, nonProfaneParsedPoem)
 	if !(err == nil && badR == false) {
 		t.Logf("Error: %s", err.Error())
 		t.Logf("Bad regex with good length: %t", badR)
@@ -32,16 +54,12 @@ func TestCanBlackout(t *testing.T) {
 func TestSearchingIsDeterministic(t *testing.T) {
 	regexpString := msg2regex("a very long message")
 	blackoutRegex := regexp.MustCompile(regexpString)
-	setupErr := setupDataFolder()
+	stores, setupErr := setupDataFolder([]string{publicDomainCorpus}, 0)
 	if setupErr != nil {
 		t.Fatalf(setupErr.Error())
 	}
-	dir, dirErr := os.ReadDir("testdata/poems_folder")
-	if dirErr != nil {
-		t.Fatalf(dirErr.Error())
-	}
 	for nThreads := 1; nThreads < 10; nThreads++ {
-		sp := SearchParams{dataFolderPoems, len(dir), nThreads, blackoutRegex, MaxLength, Profanities}
+		sp := SearchParams{stores, stores.Len(), nThreads, regexMatcher{blackoutRegex}, MatchOptions{Mode: ModeLetters}, nil, MaxLength, Profanities, false}
 		poemID, searchErr := searchPoemsFolder(sp)
 		if searchErr != nil {
 			t.Fatalf(searchErr.Error())
@@ -57,3 +75,187 @@ func TestSearchingIsDeterministic(t *testing.T) {
 		}
 	}
 }
+
+func TestRandomSearchIsReproducible(t *testing.T) {
+	store := newTestStore(t, []Poem{nonProfanePoem, profanePoem, {"Amet", "Ipsum", "Amet Sit Dolor"}, {"Sit", "Ipsum", "Sit"}})
+	matcher, err := newMatcher("it", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := SearchParams{PoemStores{store}, store.Len(), 2, matcher, MatchOptions{Mode: ModeLetters}, countRunes("it"), MaxLength, false, false}
+	poemIDs, searchErr := searchAllPoems(sp)
+	if searchErr != nil {
+		t.Fatal(searchErr)
+	}
+	if !slices.Equal(poemIDs, []int{0, 2, 3}) {
+		t.Fatalf("Unexpected matching poems: %v", poemIDs)
+	}
+	for seed := int64(0); seed < 10; seed++ {
+		poemID, searchErr := searchRandomPoem(sp, seed)
+		if searchErr != nil {
+			t.Fatal(searchErr)
+		}
+		for i := 0; i < 10; i++ {
+			loopPoemID, _ := searchRandomPoem(sp, seed)
+			if loopPoemID != poemID {
+				t.Fatalf("%d != %d", loopPoemID, poemID)
+			}
+		}
+	}
+}
+
+func BenchmarkSearchingAllPoems(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	// Search the public domain dataset if it has been downloaded, or else a store of synthetic poems
+	stores := PoemStores{}
+	corpus, _ := newCorpus(publicDomainCorpus)
+	if store, err := openPoemStore(corpus.Store); err == nil {
+		stores = append(stores, store)
+	} else {
+		b.Logf("The public domain dataset isn't set up (%s); searching synthetic poems instead", err)
+		stores = append(stores, newTestStore(b, syntheticPoems(5000)))
+	}
+	for _, message := range []string{"a very long message", "quixotic jazz box"} {
+		matcher, err := newMatcher(message, MatchOptions{Mode: ModeLetters})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(message+"/matcher only", func(b *testing.B) {
+			benchmarkSearchingAllPoems(b, SearchParams{stores, stores.Len(), runtime.NumCPU(), matcher, MatchOptions{Mode: ModeLetters}, nil, MaxLength, Profanities, false})
+		})
+		b.Run(message+"/rune count prefilter", func(b *testing.B) {
+			benchmarkSearchingAllPoems(b, SearchParams{stores, stores.Len(), runtime.NumCPU(), matcher, MatchOptions{Mode: ModeLetters}, countRunes(message), MaxLength, Profanities, false})
+		})
+	}
+}
+
+// syntheticPoems makes the given number of poems out of random lines of common words, the same every time.
+func syntheticPoems(nPoems int) []Poem {
+	words := strings.Fields("the a of and to in is it that was he for on are as with his they at be this from have or by " +
+		"one had not but what all were when we there can an your which their said if do will each about how up out them")
+	rng := rand.New(rand.NewSource(1))
+	poems := make([]Poem, nPoems)
+	for idx := range poems {
+		lines := make([]string, 4+rng.Intn(8))
+		for lineIdx := range lines {
+			lineWords := make([]string, 3+rng.Intn(6))
+			for wordIdx := range lineWords {
+				lineWords[wordIdx] = words[rng.Intn(len(words))]
+			}
+			lines[lineIdx] = strings.Join(lineWords, " ")
+		}
+		poems[idx] = Poem{fmt.Sprintf("Poem %d", idx), "Someone", strings.Join(lines, "\\n")}
+	}
+	return poems
+}
+
+// benchmarkSearchingAllPoems benchmarks searching every poem with the given search parameters.
+func benchmarkSearchingAllPoems(b *testing.B, sp SearchParams) {
+	for i := 0; i < b.N; i++ {
+		searchAllPoems(sp)
+	}
+}
+
+func TestMessagePieces(t *testing.T) {
+	if pieces := messagePieces(" ab c", ModeLetters); !slices.Equal(pieces, []string{" a", "b", " c"}) {
+		t.Fatalf("Unexpected letter pieces: %q", pieces)
+	}
+	if pieces := messagePieces(" ab  cd e ", ModeWords); !slices.Equal(pieces, []string{" ab", "  cd", " e "}) {
+		t.Fatalf("Unexpected word pieces: %q", pieces)
+	}
+}
+
+func TestSearchConsecutivePoems(t *testing.T) {
+	store := newTestStore(t, []Poem{{"Lorem", "Ipsum", "lorem"}, {"Dolor", "Ipsum", "dolor sit"}, {"Amet", "Ipsum", "amet"}})
+	message := "dolor sit amet"
+	matcher, err := newMatcher(message, MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := SearchParams{PoemStores{store}, store.Len(), 2, matcher, MatchOptions{Mode: ModeWords}, countRunes(message), MaxLength, false, false}
+	_, searchErr := searchPoemsFolder(sp)
+	if searchErr == nil {
+		t.Fatal("No single poem should fit the message")
+	}
+	parts, spreadErr := searchConsecutivePoems(sp, message, 3)
+	if spreadErr != nil {
+		t.Fatal(spreadErr)
+	}
+	expected := []MessagePart{{1, "dolor sit", nil}, {2, "amet", nil}}
+	if !slices.Equal(parts, expected) {
+		t.Fatalf("Unexpected message parts: %v", parts)
+	}
+	_, spreadErr = searchConsecutivePoems(sp, message, 1)
+	if spreadErr == nil {
+		t.Fatal("Message should not fit in a single poem")
+	}
+	if _, spreadErr = searchConsecutivePoems(sp, " ", 2); spreadErr == nil {
+		t.Fatal("Empty messages should not be spread")
+	}
+}
+
+func TestSearchSplitPoems(t *testing.T) {
+	store := newTestStore(t, []Poem{{"Lorem", "Ipsum", "lorem ipsum"}, {"Dolor", "Ipsum", "dolor sit amet"}})
+	message := "lorem dolor sit amet"
+	sp := SearchParams{PoemStores{store}, store.Len(), 2, nil, MatchOptions{Mode: ModeWords}, nil, MaxLength, false, false}
+	parts, splitErr := searchSplitPoems(sp, message)
+	if splitErr != nil {
+		t.Fatal(splitErr)
+	}
+	expected := []MessagePart{{0, "lorem", nil}, {1, "dolor sit amet", nil}}
+	if !slices.Equal(parts, expected) {
+		t.Fatalf("Unexpected message parts: %v", parts)
+	}
+	_, splitErr = searchSplitPoems(sp, "lorem consectetur")
+	if splitErr == nil {
+		t.Fatal("Words that fit no poem should fail")
+	}
+	if _, splitErr = searchSplitPoems(sp, ""); splitErr == nil {
+		t.Fatal("Empty messages should not be split")
+	}
+}
+
+func TestSearchingExcerpts(t *testing.T) {
+	store := newTestStore(t, []Poem{nonProfanePoem, {stanzaPoem.Title, stanzaPoem.Author, stanzaPoem.Text}})
+	message := "amet elit"
+	matcher, err := newMatcher(message, MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := SearchParams{PoemStores{store}, store.Len(), 2, matcher, MatchOptions{Mode: ModeWords}, countRunes(message), 50, false, false}
+	if _, searchErr := searchPoemsFolder(sp); searchErr == nil {
+		t.Fatal("Poems longer than the maximum length should be skipped")
+	}
+	sp.Excerpts = true
+	poemID, searchErr := searchPoemsFolder(sp)
+	if searchErr != nil || poemID != 1 {
+		t.Fatalf("Unexpected poem with an excerpt that fits: %d, %v", poemID, searchErr)
+	}
+	excerpt, ok := readSearchablePoem(0, poemID, sp)
+	if !ok || excerpt.Excerpt == nil || *excerpt.Excerpt != (Excerpt{2, 3, 3, 6}) {
+		t.Fatalf("Unexpected excerpt: %+v, %t", excerpt, ok)
+	}
+}
+
+func TestSpreadingExcerpts(t *testing.T) {
+	store := newTestStore(t, []Poem{{"Lorem", "Ipsum", "lorem"}, {stanzaPoem.Title, stanzaPoem.Author, stanzaPoem.Text}})
+	message := "lorem adipiscing elit"
+	matcher, err := newMatcher(message, MatchOptions{Mode: ModeWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := SearchParams{PoemStores{store}, store.Len(), 2, matcher, MatchOptions{Mode: ModeWords}, nil, 30, false, true}
+	// The excerpt of the long poem is chosen for its own part of the message
+	parts, spreadErr := searchConsecutivePoems(sp, message, 2)
+	if spreadErr != nil {
+		t.Fatal(spreadErr)
+	}
+	if len(parts) != 2 || parts[0].ID != 0 || parts[0].Message != "lorem" || parts[0].Excerpt != nil {
+		t.Fatalf("Unexpected message parts: %+v", parts)
+	}
+	excerpt := parts[1].Excerpt
+	if parts[1].ID != 1 || parts[1].Message != "adipiscing elit" || excerpt == nil || *excerpt.Excerpt != (Excerpt{3, 3, 5, 6}) {
+		t.Fatalf("Unexpected message part with an excerpt: %+v", parts[1])
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// storeMagic is the signature at the start of every poem store file.
+const storeMagic = "BLKPOEMS"
+
+// storeVersion is the version of the poem store file format. Stores with other versions have to be rebuilt.
+const storeVersion = 3
+
+// storeHeaderSize is the size of a poem store's header [bytes]: the signature, the version, and the number of poems.
+const storeHeaderSize = len(storeMagic) + 4 + 8
+
+// errStoreVersion is returned when opening a poem store written with a different version of the file format.
+var errStoreVersion = errors.New("Poem store has an unsupported version")
+
+// A PoemStore holds every parsed poem of a dataset in a single file, loaded into memory at once.
+//
+// The file starts with a header, followed by an index of the offsets where each poem's record starts (and one more
+// for where the last one ends), followed by the records themselves.
+type PoemStore struct {
+	data    []byte // The poem store file's contents.
+	nPoems  int    // The number of poems in the store.
+	records int    // The offset where the poem records start.
+}
+
+// PoemStores are several poem stores searched as one, numbering the poems of each store after the ones of the stores
+// before it.
+type PoemStores []*PoemStore
+
+// writePoemStore writes the parsed poems to a new poem store file at the given path.
+func writePoemStore(parsedPoems []ParsedPoem, storePath string) error {
+	// Encode every poem record, keeping track of where they start
+	records := []byte{}
+	offsets := make([]byte, 0, 8*(len(parsedPoems)+1))
+	for _, parsedPoem := range parsedPoems {
+		offsets = binary.LittleEndian.AppendUint64(offsets, uint64(len(records)))
+		records = appendPoemRecord(records, parsedPoem)
+	}
+	offsets = binary.LittleEndian.AppendUint64(offsets, uint64(len(records)))
+	// Put together the header, index & records
+	data := make([]byte, 0, storeHeaderSize+len(offsets)+len(records))
+	data = append(data, storeMagic...)
+	data = binary.LittleEndian.AppendUint32(data, storeVersion)
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(parsedPoems)))
+	data = append(data, offsets...)
+	data = append(data, records...)
+	// Write to a temporary file first, so that an interrupted write doesn't leave a broken store behind
+	tmpFile := storePath + ".tmp"
+	writeErr := os.WriteFile(tmpFile, data, 0o666)
+	if writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmpFile, storePath)
+}
+
+// appendPoemStore adds the parsed poems to the end of the poem store file at the given path, so that the poems already
+// in it keep their IDs.
+func appendPoemStore(parsedPoems []ParsedPoem, storePath string) error {
+	store, err := openPoemStore(storePath)
+	if err != nil {
+		return err
+	}
+	allPoems := make([]ParsedPoem, 0, store.Len()+len(parsedPoems))
+	for poemID := range store.Len() {
+		parsedPoem, poemErr := store.Poem(poemID)
+		if poemErr != nil {
+			return poemErr
+		}
+		allPoems = append(allPoems, parsedPoem)
+	}
+	return writePoemStore(append(allPoems, parsedPoems...), storePath)
+}
+
+// openPoemStore reads the poem store file at the given path and checks its header and index, so that reading its
+// poems can't go out of bounds.
+func openPoemStore(storePath string) (*PoemStore, error) {
+	data, err := os.ReadFile(storePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < storeHeaderSize || !bytes.Equal(data[:len(storeMagic)], []byte(storeMagic)) {
+		return nil, fmt.Errorf("%s is not a poem store", filepath.Base(storePath))
+	}
+	version := binary.LittleEndian.Uint32(data[len(storeMagic):])
+	if version != storeVersion {
+		return nil, fmt.Errorf("%w (%d != %d)", errStoreVersion, version, storeVersion)
+	}
+	nPoems := binary.LittleEndian.Uint64(data[len(storeMagic)+4:])
+	if nPoems > uint64(len(data)-storeHeaderSize)/8 {
+		return nil, fmt.Errorf("Poem store %s has a truncated index", filepath.Base(storePath))
+	}
+	store := &PoemStore{data, int(nPoems), storeHeaderSize + 8*(int(nPoems)+1)}
+	if store.records > len(data) {
+		return nil, fmt.Errorf("Poem store %s is truncated", filepath.Base(storePath))
+	}
+	// Every poem record has to start after the one before it, and the last one has to end with the file
+	previous := uint64(0)
+	for poemID := 0; poemID <= store.nPoems; poemID++ {
+		entry := binary.LittleEndian.Uint64(data[storeHeaderSize+8*poemID:])
+		if entry < previous || entry > uint64(len(data)-store.records) {
+			return nil, fmt.Errorf("Poem store %s has a corrupt index", filepath.Base(storePath))
+		}
+		previous = entry
+	}
+	if store.offset(store.nPoems) != len(data) {
+		return nil, fmt.Errorf("Poem store %s is truncated", filepath.Base(storePath))
+	}
+	return store, nil
+}
+
+// Len returns the number of poems in the store.
+func (ps *PoemStore) Len() int {
+	return ps.nPoems
+}
+
+// Poem decodes the parsed poem with the given ID from the store.
+func (ps *PoemStore) Poem(poemID int) (ParsedPoem, error) {
+	parsedPoem, _, err := ps.PoemIf(poemID, nil)
+	return parsedPoem, err
+}
+
+// PoemIf decodes the parsed poem with the given ID from the store, but only decodes its title, author and text if the
+// rest of it passes the check. It signals whether the poem passed, which it always does without a check.
+func (ps *PoemStore) PoemIf(poemID int, check func(ParsedPoem) bool) (ParsedPoem, bool, error) {
+	if poemID < 0 || poemID >= ps.nPoems {
+		return ParsedPoem{}, false, fmt.Errorf("Poem %d is not in the store", poemID)
+	}
+	return readPoemRecord(ps.data[ps.offset(poemID):ps.offset(poemID+1)], check)
+}
+
+// Len returns the number of poems in all the stores.
+func (ps PoemStores) Len() int {
+	nPoems := 0
+	for _, store := range ps {
+		nPoems += store.Len()
+	}
+	return nPoems
+}
+
+// Poem decodes the parsed poem with the given ID from the store that it's in.
+func (ps PoemStores) Poem(poemID int) (ParsedPoem, error) {
+	parsedPoem, _, err := ps.PoemIf(poemID, nil)
+	return parsedPoem, err
+}
+
+// PoemIf decodes the parsed poem with the given ID from the store that it's in, like PoemStore.PoemIf.
+func (ps PoemStores) PoemIf(poemID int, check func(ParsedPoem) bool) (ParsedPoem, bool, error) {
+	storeID := poemID
+	for _, store := range ps {
+		if storeID >= 0 && storeID < store.Len() {
+			return store.PoemIf(storeID, check)
+		}
+		storeID -= store.Len()
+	}
+	return ParsedPoem{}, false, fmt.Errorf("Poem %d is not in the stores", poemID)
+}
+
+// offset returns the file offset where the record of the poem with the given ID starts.
+func (ps *PoemStore) offset(poemID int) int {
+	indexEntry := ps.data[storeHeaderSize+8*poemID:]
+	return ps.records + int(binary.LittleEndian.Uint64(indexEntry))
+}
+
+// appendPoemRecord encodes the parsed poem as a record, and appends it to the byte slice.
+func appendPoemRecord(record []byte, parsedPoem ParsedPoem) []byte {
+	for _, field := range []string{parsedPoem.Title, parsedPoem.Author, parsedPoem.Text} {
+		record = binary.AppendUvarint(record, uint64(len(field)))
+		record = append(record, field...)
+	}
+	record = binary.AppendUvarint(record, uint64(parsedPoem.Length))
+	if parsedPoem.IsProfane {
+		record = append(record, 1)
+	} else {
+		record = append(record, 0)
+	}
+	record = binary.AppendUvarint(record, uint64(parsedPoem.Offset))
+	if parsedPoem.IsWindow {
+		record = append(record, 1)
+	} else {
+		record = append(record, 0)
+	}
+	// Sort the rune counts, so that the same poem always makes the same record
+	runes := make([]rune, 0, len(parsedPoem.RuneCounts))
+	for r := range parsedPoem.RuneCounts {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+	record = binary.AppendUvarint(record, uint64(len(runes)))
+	for _, r := range runes {
+		record = binary.AppendUvarint(record, uint64(r))
+		record = binary.AppendUvarint(record, uint64(parsedPoem.RuneCounts[r]))
+	}
+	return record
+}
+
+// readPoemRecord decodes the parsed poem from the given record. If there is a check, then the poem's title, author and
+// text are only decoded after the rest of the poem passes it, since copying them is most of the decoding's work. It
+// signals whether the poem passed the check.
+func readPoemRecord(record []byte, check func(ParsedPoem) bool) (ParsedPoem, bool, error) {
+	var parsedPoem ParsedPoem
+	errCorrupt := errors.New("Poem record is corrupt")
+	fields := make([][]byte, 3)
+	for idx := range fields {
+		fieldLen, n := binary.Uvarint(record)
+		if n <= 0 || fieldLen > uint64(len(record)-n) {
+			return parsedPoem, false, errCorrupt
+		}
+		fields[idx] = record[n : n+int(fieldLen)]
+		record = record[n+int(fieldLen):]
+	}
+	length, n := binary.Uvarint(record)
+	if n <= 0 || len(record) < n+1 {
+		return parsedPoem, false, errCorrupt
+	}
+	parsedPoem.Length = int(length)
+	parsedPoem.IsProfane = record[n] == 1
+	record = record[n+1:]
+	offset, n := binary.Uvarint(record)
+	if n <= 0 || len(record) < n+1 {
+		return parsedPoem, false, errCorrupt
+	}
+	parsedPoem.Offset = int(offset)
+	parsedPoem.IsWindow = record[n] == 1
+	record = record[n+1:]
+	// The rest of the record is the number of distinct runes, then each rune with its count
+	nRunes, n := binary.Uvarint(record)
+	if n <= 0 || nRunes > uint64(len(record)) {
+		return parsedPoem, false, errCorrupt
+	}
+	record = record[n:]
+	parsedPoem.RuneCounts = make(map[rune]int, nRunes)
+	for i := uint64(0); i < nRunes; i++ {
+		r, rn := binary.Uvarint(record)
+		if rn <= 0 {
+			return parsedPoem, false, errCorrupt
+		}
+		count, cn := binary.Uvarint(record[rn:])
+		if cn <= 0 {
+			return parsedPoem, false, errCorrupt
+		}
+		parsedPoem.RuneCounts[rune(r)] = int(count)
+		record = record[rn+cn:]
+	}
+	if len(record) != 0 {
+		return parsedPoem, false, errCorrupt
+	}
+	if check != nil && !check(parsedPoem) {
+		return parsedPoem, false, nil
+	}
+	parsedPoem.Title, parsedPoem.Author, parsedPoem.Text = string(fields[0]), string(fields[1]), string(fields[2])
+	return parsedPoem, true, nil
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// samePoem signals whether the two parsed poems have the same contents.
+func samePoem(first ParsedPoem, second ParsedPoem) bool {
+	return first.Title == second.Title && first.Author == second.Author && first.Text == second.Text &&
+		first.Length == second.Length && first.IsProfane == second.IsProfane &&
+		maps.Equal(first.RuneCounts, second.RuneCounts) && first.Offset == second.Offset && first.IsWindow == second.IsWindow
+}
+
+func TestPoemStoreRoundTrip(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "poems.store")
+	parsedPoems := []ParsedPoem{nonProfaneParsedPoem, NewParsedPoem(profanePoem), {}}
+	writeErr := writePoemStore(parsedPoems, storePath)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	store, openErr := openPoemStore(storePath)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	if store.Len() != len(parsedPoems) {
+		t.Fatalf("Store has %d poems instead of %d", store.Len(), len(parsedPoems))
+	}
+	for poemID, parsedPoem := range parsedPoems {
+		storePoem, poemErr := store.Poem(poemID)
+		if poemErr != nil {
+			t.Fatal(poemErr)
+		}
+		if !samePoem(storePoem, parsedPoem) {
+			t.Fatal("Original poem and store-read poem do not match")
+		}
+	}
+	_, poemErr := store.Poem(len(parsedPoems))
+	if poemErr == nil {
+		t.Fatal("Reading a poem past the end of the store should fail")
+	}
+	// Poems that fail the check are read without their title, author and text
+	isShort := func(parsedPoem ParsedPoem) bool { return parsedPoem.Length < 5 }
+	if poem, ok, err := store.PoemIf(0, isShort); err != nil || ok || poem.Text != "" || poem.Length != nonProfaneParsedPoem.Length {
+		t.Fatalf("Unexpected poem failing the check: %+v, %t, %v", poem, ok, err)
+	}
+	if poem, ok, err := store.PoemIf(2, isShort); err != nil || !ok || !samePoem(poem, parsedPoems[2]) {
+		t.Fatalf("Unexpected poem passing the check: %+v, %t, %v", poem, ok, err)
+	}
+}
+
+func TestPoemStoreRejectsBadFiles(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "poems.store")
+	writeErr := writePoemStore([]ParsedPoem{nonProfaneParsedPoem}, storePath)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	data, readErr := os.ReadFile(storePath)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	// Truncated store
+	os.WriteFile(storePath, data[:len(data)-1], 0o666)
+	_, openErr := openPoemStore(storePath)
+	if openErr == nil {
+		t.Fatal("Truncated poem stores should not open")
+	}
+	// Stores with index entries out of range or out of order
+	twoPoemsPath := filepath.Join(t.TempDir(), "poems.store")
+	if err := writePoemStore([]ParsedPoem{nonProfaneParsedPoem, NewParsedPoem(profanePoem)}, twoPoemsPath); err != nil {
+		t.Fatal(err)
+	}
+	twoPoems, _ := os.ReadFile(twoPoemsPath)
+	for _, entry := range []uint64{^uint64(0), 1 << 62, uint64(len(twoPoems)), 0} {
+		corrupt := slices.Clone(twoPoems)
+		binary.LittleEndian.PutUint64(corrupt[storeHeaderSize+8:], entry)
+		if entry == 0 {
+			// The second record can't start before the first one
+			binary.LittleEndian.PutUint64(corrupt[storeHeaderSize:], 1)
+		}
+		os.WriteFile(twoPoemsPath, corrupt, 0o666)
+		if _, openErr := openPoemStore(twoPoemsPath); openErr == nil {
+			t.Fatalf("Poem store with index entry %d should not open", entry)
+		}
+	}
+	// Store with another format version
+	data[len(storeMagic)]++
+	os.WriteFile(storePath, data, 0o666)
+	_, openErr = openPoemStore(storePath)
+	if !errors.Is(openErr, errStoreVersion) {
+		t.Fatalf("Unexpected error for poem store with another version: %v", openErr)
+	}
+	// Not a store at all
+	os.WriteFile(storePath, []byte("[]"), 0o666)
+	_, openErr = openPoemStore(storePath)
+	if openErr == nil {
+		t.Fatal("JSON files should not open as poem stores")
+	}
+}
+
+func TestPoemStores(t *testing.T) {
+	amet := Poem{"Amet", "Ipsum", "Amet Sit Dolor"}
+	stores := PoemStores{newTestStore(t, []Poem{nonProfanePoem, profanePoem}), newTestStore(t, []Poem{}), newTestStore(t, []Poem{amet})}
+	if stores.Len() != 3 {
+		t.Fatalf("Stores have %d poems instead of 3", stores.Len())
+	}
+	for poemID, poem := range []Poem{nonProfanePoem, profanePoem, amet} {
+		storePoem, err := stores.Poem(poemID)
+		if err != nil || !samePoem(storePoem, NewParsedPoem(poem)) {
+			t.Fatalf("Unexpected poem %d: %+v, %v", poemID, storePoem, err)
+		}
+	}
+	for _, poemID := range []int{-1, 3} {
+		if _, err := stores.Poem(poemID); err == nil {
+			t.Fatalf("Reading poem %d should fail", poemID)
+		}
+	}
+}
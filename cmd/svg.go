@@ -0,0 +1,79 @@
+/*
+Package cmd contains the necessary functions to execute the code for `blackout`.
+
+Copyright © 2024 Vincent Mercator <vmercator@protonmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const (
+	svgFontSize   = 16.0              // The font size of the SVG's text [px].
+	svgCharWidth  = 0.6 * svgFontSize // The width of a character column, which kept text is stretched to fill [px].
+	svgLineHeight = 1.5 * svgFontSize // The distance between two lines of text [px].
+	svgMargin     = 2 * svgFontSize   // The margin around the SVG's contents [px].
+	svgFontFamily = `Georgia, 'Times New Roman', 'Nimbus Roman', 'Liberation Serif', serif`
+)
+
+// WriteSVG draws the blackout poems one after another as a single SVG image, with black bars over the erased text and
+// each poem's attribution below it.
+func WriteSVG(w io.Writer, blackouts []Blackout) error {
+	var body strings.Builder
+	columns := 0
+	y := svgMargin
+	for idx, b := range blackouts {
+		if idx > 0 {
+			y += svgLineHeight
+		}
+		for _, line := range b.Lines() {
+			y += svgLineHeight
+			column := 0
+			for _, run := range line {
+				x := svgMargin + float64(column)*svgCharWidth
+				width := float64(textWidth(run.Text)) * svgCharWidth
+				switch {
+				case run.Kept:
+					fmt.Fprintf(&body, "    <text x=\"%.1f\" y=\"%.1f\" textLength=\"%.1f\" lengthAdjust=\"spacingAndGlyphs\">%s</text>\n",
+						x, y, width, html.EscapeString(run.Text))
+				case run.Erased:
+					fmt.Fprintf(&body, "    <rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\"/>\n",
+						x, y-0.8*svgFontSize, width, svgFontSize)
+				}
+				column += textWidth(run.Text)
+			}
+			columns = max(columns, column)
+		}
+		y += 2 * svgLineHeight
+		attribution := b.Attribution()
+		fmt.Fprintf(&body, "    <text x=\"%.1f\" y=\"%.1f\" font-style=\"italic\">%s</text>\n",
+			svgMargin, y, html.EscapeString(attribution))
+		columns = max(columns, textWidth(attribution))
+	}
+	width := 2*svgMargin + float64(columns)*svgCharWidth
+	height := y + svgMargin
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.1f" height="%.1f" viewBox="0 0 %.1f %.1f">
+  <rect width="100%%" height="100%%" fill="white"/>
+  <g font-family="%s" font-size="%.0f" fill="black" xml:space="preserve">
+%s  </g>
+</svg>
+`, width, height, width, height, svgFontFamily, svgFontSize, body.String())
+	return err
+}
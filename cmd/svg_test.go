@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+	poem := NewParsedPoem(Poem{"<Lorem> & Co", "Ipsum", "Dolor Sit\\nAmet"})
+	b, err := newBlackout(0, poem, "it me", MatchOptions{Mode: ModeLetters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, []Blackout{b, b}); err != nil {
+		t.Fatal(err)
+	}
+	// The SVG has to be well-formed, with a bar per erased run and the kept text
+	decoder := xml.NewDecoder(&buf)
+	rects, texts := 0, []string{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Malformed SVG: %s", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "rect":
+				rects++
+			case "text":
+				var text string
+				if err := decoder.DecodeElement(&text, &start); err != nil {
+					t.Fatal(err)
+				}
+				texts = append(texts, text)
+			}
+		}
+	}
+	// The background, then "Dolor", "S", "A" & "t" for each poem
+	if rects != 1+2*4 {
+		t.Fatalf("Unexpected number of bars: %d", rects)
+	}
+	expected := []string{"it", "me", `Excerpt of "<Lorem> & Co" by Ipsum`}
+	if strings.Join(texts, "|") != strings.Join(append(expected, expected...), "|") {
+		t.Fatalf("Unexpected texts: %q", texts)
+	}
+}
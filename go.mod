@@ -5,9 +5,14 @@ go 1.22.5
 require (
 	github.com/TwiN/go-away v1.6.13 // direct
 	github.com/adrg/xdg v0.5.0 // direct
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // direct
 	github.com/spf13/cobra v1.8.1 // direct
+	golang.org/x/image v0.18.0 // direct
+	golang.org/x/text v0.16.0 // direct
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 )